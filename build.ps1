@@ -112,6 +112,8 @@ function Docker-Dev {
     $env:TIME_SUBTRACTION_MS = 100
     $env:TIME_MULTIPLICATIONS_MS = 200
     $env:TIME_DIVISIONS_MS = 200
+    $env:TIME_POWER_MS = 200
+    $env:TIME_MODULO_MS = 200
     docker-compose up -d
 }
 
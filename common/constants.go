@@ -16,10 +16,58 @@ const (
 	ErrDivisionByZero          = "division by zero"
 	ErrModuloByZero            = "modulo by zero"
 	ErrInvalidModulo           = "modulo operation requires integer operands"
+	ErrNonFiniteResult         = "result is not a finite number"
+	ErrUnresolvedOperand       = "task operand is not resolved"
+	ErrInvalidFragment         = "invalid task fragment"
+	ErrLeaseNotHeld            = "task lease is not held"
+	ErrLeaseExpired            = "task lease expired"
+	ErrTaskAttemptsExhausted   = "operation %q failed after %d attempts: %s"
+	ErrDeadLetterNotFound      = "Dead letter not found"
+	ErrExpressionFinished      = "expression is already finished"
+	ErrExpressionTimeout       = "expression timed out after %d ms"
+	ErrInvalidTimeout          = "invalid timeout"
 	ErrUnexpectedEndExpr       = "unexpected end of expression"
 	ErrMissingCloseParen       = "missing closing parenthesis"
+	ErrMissingCloseAbs         = "missing closing absolute value bar"
+	ErrFactorialNegative       = "factorial of a negative integer is undefined"
+	ErrMaxLengthExceeded       = "expression length limit exceeded"
+	ErrMaxTokensExceeded       = "token limit exceeded"
+	ErrMaxDepthExceeded        = "nesting depth limit exceeded"
+	ErrMaxMagnitudeExceeded    = "magnitude limit exceeded"
+	ErrEvaluationCanceled      = "evaluation canceled"
+	ErrUnexpectedCharacter     = "unexpected character"
+	ErrMalformedNumber         = "malformed number"
+	ErrInvalidFormatDigits     = "invalid format digits"
+	ErrInvalidRoundingMode     = "invalid rounding mode"
+	ErrInvalidNotation         = "invalid notation"
+	ErrMaxElementsExceeded     = "list size limit exceeded"
+	ErrDimensionMismatch       = "dimension mismatch"
+	ErrRangeBoundsNotScalar    = "range bounds must be numbers"
+	ErrNestedList              = "lists nested deeper than a matrix are not supported"
+	ErrMatrixRows              = "matrix rows must be non-empty lists of equal length"
+	ErrMatrixOperator          = "operator is not supported for matrices"
+	ErrSingularMatrix          = "matrix is singular"
+	ErrFunctionArity           = "wrong number of arguments"
+	ErrMissingOperand          = "missing operand"
+	ErrUnknownVariable         = "unknown variable"
+	ErrConstructArguments      = "expected a variable, lower and upper bounds and a body"
+	ErrBoundsNotScalar         = "bounds must be numbers"
+	ErrBoundsNotFinite         = "bounds must be finite numbers"
+	ErrBodyNotScalar           = "body must evaluate to a number"
+	ErrUnknownWord             = "unknown word"
+	ErrMisplacedNumberWord     = "misplaced number word"
+	ErrEmptyPhrase             = "phrase contains no expression"
+	ErrUnknownMode             = "unknown input mode"
+	ErrUnknownInputNotation    = "unknown input notation"
+	ErrNotDistributable        = "only numeric expressions, matrix products, sums and products can be distributed"
+	ErrMissingCloseBracket     = "missing closing bracket"
+	ErrUnknownFunction         = "unknown function"
+	ErrEmptyAggregate          = "aggregate of an empty list"
+	ErrStdevTooFewValues       = "standard deviation requires at least two values"
+	ErrNotScalar               = "expression does not evaluate to a number"
 	ErrFailedProcessExpression = "Failed to process expression"
 	ErrFailedProcessResult     = "Failed to process result"
+	ErrFailedBuildSteps        = "Failed to build calculation steps"
 	ErrFailedStartServer       = "Failed to start server"
 	ErrServerShutdownFailed    = "Server shutdown failed"
 )
@@ -31,12 +79,17 @@ const (
 	LogAgentStarted               = "Agent service started successfully"
 	LogAgentStoppedGrace          = "Agent service stopped gracefully"
 	LogFailedSendResult           = "failed to send result"
+	LogFailedSendFailure          = "failed to send task failure"
 	LogNoTasksAvailable           = "No tasks available"
 	LogFailedDecodeTask           = "Failed to decode task result"
 	LogFailedUpdateTask           = "Failed to update task result"
+	LogFailedExtendLease          = "Failed to extend task lease"
 	LogFailedGetTaskResult        = "Failed to get task after updating result"
 	LogFailedUpdateExpr           = "Failed to update expression result"
 	LogTaskProcessed              = "Task result processed successfully"
+	LogTaskFailed                 = "Agent failed to calculate task"
+	LogExpressionCancelled        = "Expression cancelled"
+	LogExpressionTimedOut         = "Expression timed out"
 	LogOrchestratorStarted        = "Orchestrator service started successfully"
 	LogOrchestratorStoppedGrace   = "Orchestrator service stopped gracefully"
 	LogInvalidStatusTransition    = "Invalid status transition"
@@ -44,6 +97,10 @@ const (
 	LogFailedUpdateStatusNotFound = "Failed to update expression status: expression not found"
 	LogListedAllExpressions       = "Listed all expressions"
 	LogFailedParseExpression      = "Failed to parse expression"
+	LogInvalidFormatOptions       = "Invalid format options"
+	LogFailedTranslateNatural     = "Failed to translate natural language expression"
+	LogFailedFormatResult         = "Failed to format expression result"
+	LogFailedBuildSteps           = "Failed to build calculation steps"
 )
 
 // HTTP headers and content types used in the application.
@@ -54,8 +111,13 @@ const (
 
 // URL paths used for API endpoints.
 const (
-	PathTask         = "/task"
-	PathInternalTask = "%s/internal/task"
+	PathTask              = "/task"
+	PathTaskLease         = "/task/{id}/lease"
+	PathCache             = "/cache"
+	PathDeadLetters       = "/dead-letters"
+	PathDeadLetterRequeue = "/dead-letters/{id}/requeue"
+	PathInternalTask      = "%s/internal/task"
+	PathInternalTaskLease = "%s/internal/task/%s/lease"
 )
 
 // Field names used in JSON and other data structures.
@@ -88,6 +150,8 @@ const (
 	LogFailedParseParentheses = "Failed to parse expression in parentheses"
 	LogMissingCloseParen      = "Missing closing parenthesis"
 	LogFailedParseNegative    = "Failed to parse negative factor"
+	LogFailedParseAbs         = "Failed to parse expression in absolute value bars"
+	LogMissingCloseAbs        = "Missing closing absolute value bar"
 	LogInvalidNumberFormat    = "Invalid number format"
 	LogUnexpectedToken        = "Unexpected token"
 )
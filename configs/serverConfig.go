@@ -14,6 +14,16 @@ type ServerConfig struct {
 	TimeSubtractionMS int64  // Время в миллисекундах для операций вычитания.
 	TimeMultiplyMS    int64  // Время в миллисекундах для операций умножения.
 	TimeDivisionMS    int64  // Время в миллисекундах для операций деления.
+	TimePowerMS       int64  // Время в миллисекундах для операций возведения в степень.
+	TimeModuloMS      int64  // Время в миллисекундах для операций остатка от деления.
+	ResultCacheSize   int64  // Число результатов задач в кэше; 0 отключает кэш.
+	ResultCacheTTLMS  int64  // Время жизни результата в кэше в миллисекундах; 0 - без ограничения.
+	LeaseTimeoutMS    int64  // Время аренды выданной агенту задачи в миллисекундах.
+	MaxAttempts       int64  // Число попыток выполнить задачу до переноса в недоставленные.
+	RetryBackoffMS    int64  // Задержка перед повторной выдачей задачи в миллисекундах, удваивается с каждой попыткой.
+	DefaultTimeoutMS  int64  // Время на вычисление выражения, если запрос его не задает; 0 - без ограничения.
+	MaxTimeoutMS      int64  // Наибольшее время на вычисление выражения; 0 - без ограничения.
+	ComputingPower    int64  // Общее число вычислителей всех агентов; 0 отключает объединение задач.
 }
 
 // NewServerConfig creates a new ServerConfig instance with values from environment variables or defaults.
@@ -38,6 +48,56 @@ func NewServerConfig() (*ServerConfig, error) {
 		return nil, fmt.Errorf("invalid TIME_DIVISIONS_MS: %w", err)
 	}
 
+	timePow, err := getEnvInt64("TIME_POWER_MS", 100)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TIME_POWER_MS: %w", err)
+	}
+
+	timeMod, err := getEnvInt64("TIME_MODULO_MS", 100)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TIME_MODULO_MS: %w", err)
+	}
+
+	cacheSize, err := getEnvInt64("RESULT_CACHE_SIZE", 10000)
+	if err != nil {
+		return nil, fmt.Errorf("invalid RESULT_CACHE_SIZE: %w", err)
+	}
+
+	cacheTTL, err := getEnvInt64("RESULT_CACHE_TTL_MS", 600000)
+	if err != nil {
+		return nil, fmt.Errorf("invalid RESULT_CACHE_TTL_MS: %w", err)
+	}
+
+	leaseTimeout, err := getEnvInt64("TASK_LEASE_TIMEOUT_MS", 30000)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TASK_LEASE_TIMEOUT_MS: %w", err)
+	}
+
+	maxAttempts, err := getEnvInt64("TASK_MAX_ATTEMPTS", 3)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TASK_MAX_ATTEMPTS: %w", err)
+	}
+
+	retryBackoff, err := getEnvInt64("TASK_RETRY_BACKOFF_MS", 1000)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TASK_RETRY_BACKOFF_MS: %w", err)
+	}
+
+	defaultTimeout, err := getEnvInt64("EXPRESSION_TIMEOUT_MS", 0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid EXPRESSION_TIMEOUT_MS: %w", err)
+	}
+
+	maxTimeout, err := getEnvInt64("EXPRESSION_MAX_TIMEOUT_MS", 0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid EXPRESSION_MAX_TIMEOUT_MS: %w", err)
+	}
+
+	computingPower, err := getEnvInt64("TOTAL_COMPUTING_POWER", 0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TOTAL_COMPUTING_POWER: %w", err)
+	}
+
 	port := getEnvString("PORT", "8080")
 
 	return &ServerConfig{
@@ -46,6 +106,16 @@ func NewServerConfig() (*ServerConfig, error) {
 		TimeSubtractionMS: timeSub,
 		TimeMultiplyMS:    timeMul,
 		TimeDivisionMS:    timeDiv,
+		TimePowerMS:       timePow,
+		TimeModuloMS:      timeMod,
+		ResultCacheSize:   cacheSize,
+		ResultCacheTTLMS:  cacheTTL,
+		LeaseTimeoutMS:    leaseTimeout,
+		MaxAttempts:       maxAttempts,
+		RetryBackoffMS:    retryBackoff,
+		DefaultTimeoutMS:  defaultTimeout,
+		MaxTimeoutMS:      maxTimeout,
+		ComputingPower:    computingPower,
 	}, nil
 }
 
@@ -15,6 +15,8 @@ type WorkerConfig struct {
 	SubtractionTimeMS int64  // Время в миллисекундах для операций вычитания.
 	MultiplyTimeMS    int64  // Время в миллисекундах для операций умножения.
 	DivisionTimeMS    int64  // Время в миллисекундах для операций деления.
+	PowerTimeMS       int64  // Время в миллисекундах для операций возведения в степень.
+	ModuloTimeMS      int64  // Время в миллисекундах для операций остатка от деления.
 }
 
 // NewWorkerConfig создает новую конфигурацию рабочего агента.
@@ -44,6 +46,16 @@ func NewWorkerConfig() (*WorkerConfig, error) {
 		return nil, fmt.Errorf("invalid TIME_DIVISIONS_MS: %w", err)
 	}
 
+	timePow, err := getWorkerEnvInt64("TIME_POWER_MS", 100)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TIME_POWER_MS: %w", err)
+	}
+
+	timeMod, err := getWorkerEnvInt64("TIME_MODULO_MS", 100)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TIME_MODULO_MS: %w", err)
+	}
+
 	return &WorkerConfig{
 		ComputingPower:    power,
 		OrchestratorURL:   getWorkerEnvString("ORCHESTRATOR_URL", "http://localhost:8080"),
@@ -51,6 +63,8 @@ func NewWorkerConfig() (*WorkerConfig, error) {
 		SubtractionTimeMS: timeSub,
 		MultiplyTimeMS:    timeMul,
 		DivisionTimeMS:    timeDiv,
+		PowerTimeMS:       timePow,
+		ModuloTimeMS:      timeMod,
 	}, nil
 }
 
@@ -0,0 +1,162 @@
+// Package server предоставляет объединение операций выражения в задачи-фрагменты.
+package server
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/flexer2006/y.lms-sprint2-calculator/internal/server/models"
+)
+
+// fragment - поддерево выражения, которое вычисляет одна задача.
+type fragment struct {
+	op     string   // Операция корня поддерева.
+	tokens []string // Поддерево в ОПН; аргументы-задачи записаны как "#" + идентификатор.
+	inputs []string // Задачи, результаты которых нужны поддереву, в порядке появления.
+	cost   int64    // Суммарное время операций поддерева в мс.
+}
+
+// fusionBudget возвращает наибольшее время операций, которое стоит отдать одной
+// задаче: работу выражения, поровну поделенную между вычислителями агентов.
+// Более крупная задача оставила бы часть вычислителей без работы, а более мелкие
+// добавляют обмены с оркестратором. 0 означает, что объединять задачи не нужно.
+func (s *Server) fusionBudget(tasks []*models.Task) int64 {
+	if s.config.ComputingPower <= 0 {
+		return 0
+	}
+	var total int64
+	for _, task := range tasks {
+		total += task.OperationTime
+	}
+	return total / s.config.ComputingPower
+}
+
+// fuseTasks объединяет задачи в задачи-фрагменты, чтобы агент вычислял поддерево
+// выражения целиком, без обмена с оркестратором после каждой операции. Задача
+// поглощает задачи своих аргументов, если их результат больше никому не нужен,
+// суммарное время операций не превышает budget, а аргументов-задач у поддерева
+// остается не больше двух. В плане поглощенные задачи заменяются своими операциями.
+// Задачи идут в порядке планирования: зависимость раньше зависящей от нее задачи.
+func fuseTasks(tasks []*models.Task, plan []string, budget int64) ([]*models.Task, []string) {
+	if budget <= 0 {
+		return tasks, plan
+	}
+
+	refs := make(map[string]int)
+	for _, task := range tasks {
+		for _, depID := range task.Dependencies() {
+			refs[depID]++
+		}
+	}
+
+	fragments := make(map[string]*fragment, len(tasks))
+	absorbed := make(map[string]string) // Идентификатор поглощенной задачи -> ее операция.
+	for _, task := range tasks {
+		absorbable := func(arg models.Operand) bool {
+			_, planned := fragments[arg.TaskID]
+			return planned && refs[arg.TaskID] == 1
+		}
+
+		// Поглотить оба аргумента, один из них или ни одного - первое, что укладывается в бюджет.
+		var options [][2]bool
+		can1, can2 := absorbable(task.Arg1), absorbable(task.Arg2)
+		if can1 && can2 {
+			options = append(options, [2]bool{true, true})
+		}
+		if can1 {
+			options = append(options, [2]bool{true, false})
+		}
+		if can2 {
+			options = append(options, [2]bool{false, true})
+		}
+		options = append(options, [2]bool{})
+
+		for _, absorb := range options {
+			f := newFragment(task, absorb, fragments)
+			if absorb != [2]bool{} && (f.cost > budget || len(f.inputs) > 2) {
+				continue
+			}
+			for i, arg := range []models.Operand{task.Arg1, task.Arg2} {
+				if absorb[i] {
+					absorbed[arg.TaskID] = fragments[arg.TaskID].op
+				}
+			}
+			fragments[task.ID] = f
+			break
+		}
+	}
+
+	var fused []*models.Task
+	for _, task := range tasks {
+		if _, ok := absorbed[task.ID]; ok {
+			continue
+		}
+		if f := fragments[task.ID]; len(f.tokens) > 3 {
+			task.Fragment = f.agentTokens()
+			task.Arg1, task.Arg2 = models.Operand{}, models.Operand{}
+			if len(f.inputs) > 0 {
+				task.Arg1 = models.Ref(f.inputs[0])
+			}
+			if len(f.inputs) > 1 {
+				task.Arg2 = models.Ref(f.inputs[1])
+			}
+			task.OperationTime = f.cost
+		}
+		fused = append(fused, task)
+	}
+
+	fusedPlan := make([]string, len(plan))
+	for i, token := range plan {
+		fusedPlan[i] = token
+		if op, ok := absorbed[token]; ok {
+			fusedPlan[i] = op
+		}
+	}
+	return fused, fusedPlan
+}
+
+// newFragment строит поддерево задачи, подставляя поддеревья аргументов, отмеченных в absorb.
+func newFragment(task *models.Task, absorb [2]bool, fragments map[string]*fragment) *fragment {
+	f := &fragment{op: task.Operation, cost: task.OperationTime}
+	for i, arg := range []models.Operand{task.Arg1, task.Arg2} {
+		switch {
+		case arg.TaskID == "":
+			value, _ := arg.Number()
+			f.tokens = append(f.tokens, strconv.FormatFloat(value, 'g', -1, 64))
+		case absorb[i]:
+			child := fragments[arg.TaskID]
+			f.tokens = append(f.tokens, child.tokens...)
+			f.cost += child.cost
+			f.addInputs(child.inputs...)
+		default:
+			f.tokens = append(f.tokens, "#"+arg.TaskID)
+			f.addInputs(arg.TaskID)
+		}
+	}
+	f.tokens = append(f.tokens, task.Operation)
+	return f
+}
+
+// addInputs добавляет аргументы-задачи поддерева, пропуская уже известные.
+func (f *fragment) addInputs(ids ...string) {
+	for _, id := range ids {
+		if !slices.Contains(f.inputs, id) {
+			f.inputs = append(f.inputs, id)
+		}
+	}
+}
+
+// agentTokens возвращает запись поддерева для агента: аргументы-задачи заменены
+// подстановками models.FragmentArg1 и models.FragmentArg2.
+func (f *fragment) agentTokens() []string {
+	placeholders := []string{models.FragmentArg1, models.FragmentArg2}
+	tokens := make([]string, len(f.tokens))
+	for i, token := range f.tokens {
+		tokens[i] = token
+		if id, ok := strings.CutPrefix(token, "#"); ok {
+			tokens[i] = placeholders[slices.Index(f.inputs, id)]
+		}
+	}
+	return tokens
+}
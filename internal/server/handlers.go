@@ -3,11 +3,16 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
 	"time"
 
 	"github.com/flexer2006/y.lms-sprint2-calculator/common"
 	"github.com/flexer2006/y.lms-sprint2-calculator/internal/server/models"
+	"github.com/flexer2006/y.lms-sprint2-calculator/internal/server/storage"
+	"github.com/flexer2006/y.lms-sprint2-calculator/pkg/calculation"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
@@ -30,8 +35,25 @@ func (s *Server) handleCalculate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err := s.parseExpression(req.Expression)
-	if err != nil {
+	switch req.Mode {
+	case "":
+	case models.ModeNatural:
+		expression, err := calculation.TranslateNatural(req.Expression)
+		if err != nil {
+			s.logger.Error(common.LogFailedTranslateNatural,
+				zap.String(common.FieldExpression, req.Expression),
+				zap.Error(err))
+			s.writeError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		req.Expression = expression
+	default:
+		s.logger.Warn(common.ErrUnknownMode, zap.String("mode", req.Mode))
+		s.writeError(w, http.StatusUnprocessableEntity, fmt.Sprintf("%s %q", common.ErrUnknownMode, req.Mode))
+		return
+	}
+
+	if _, err := s.parseForPlanning(req.Expression, req.Notation); err != nil {
 		s.logger.Error(common.LogFailedParseExpression,
 			zap.String(common.FieldExpression, req.Expression),
 			zap.Error(err))
@@ -40,10 +62,30 @@ func (s *Server) handleCalculate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if req.Format != nil {
+		if err := req.Format.CalculationOptions().Validate(); err != nil {
+			s.logger.Warn(common.LogInvalidFormatOptions,
+				zap.String(common.FieldExpression, req.Expression),
+				zap.Error(err))
+			s.writeError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+	}
+
+	if req.TimeoutMS < 0 || req.TimeoutMS > maxTimeoutMS {
+		s.logger.Warn(common.ErrInvalidTimeout, zap.Int64("timeoutMS", req.TimeoutMS))
+		s.writeError(w, http.StatusUnprocessableEntity, common.ErrInvalidTimeout)
+		return
+	}
+
 	expr := &models.Expression{
 		ID:         uuid.New().String(),
 		Expression: req.Expression,
+		Notation:   req.Notation,
+		Format:     req.Format,
 		Status:     models.StatusPending,
+		TimeoutMS:  s.expressionTimeout(req.TimeoutMS),
+		Priority:   req.Priority,
 		CreatedAt:  time.Now(),
 		UpdatedAt:  time.Now(),
 	}
@@ -60,6 +102,10 @@ func (s *Server) handleCalculate(w http.ResponseWriter, r *http.Request) {
 		zap.String("id", expr.ID),
 		zap.String(common.FieldExpression, expr.Expression))
 
+	if expr.TimeoutMS > 0 {
+		s.storage.ExpireAfter(expr.ID, expr.TimeoutMS)
+	}
+
 	go func() {
 		if err := s.processExpression(expr); err != nil {
 			s.logger.Error("Failed to process expression",
@@ -78,6 +124,23 @@ func (s *Server) handleCalculate(w http.ResponseWriter, r *http.Request) {
 	s.writeJSON(w, http.StatusCreated, models.CalculateResponse{ID: expr.ID})
 }
 
+// maxTimeoutMS - наибольшее время на вычисление выражения в миллисекундах,
+// представимое в time.Duration (около 292 лет).
+const maxTimeoutMS = math.MaxInt64 / int64(time.Millisecond)
+
+// expressionTimeout возвращает время на вычисление выражения в миллисекундах:
+// запрошенное, а если оно не задано - время по умолчанию, но не больше наибольшего.
+func (s *Server) expressionTimeout(requested int64) int64 {
+	timeout := requested
+	if timeout == 0 {
+		timeout = s.config.DefaultTimeoutMS
+	}
+	if s.config.MaxTimeoutMS > 0 && (timeout == 0 || timeout > s.config.MaxTimeoutMS) {
+		timeout = s.config.MaxTimeoutMS
+	}
+	return min(timeout, maxTimeoutMS)
+}
+
 // handleListExpressions список всех сохраненных выражений.
 func (s *Server) handleListExpressions(w http.ResponseWriter, _ *http.Request) {
 	exprPointers := s.storage.ListExpressions()
@@ -109,6 +172,49 @@ func (s *Server) handleGetExpression(w http.ResponseWriter, r *http.Request) {
 	s.writeJSON(w, http.StatusOK, models.ExpressionResponse{Expression: *expr})
 }
 
+// handleCancelExpression отменяет незавершенное выражение и возвращает его.
+func (s *Server) handleCancelExpression(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	expr, err := s.storage.CancelExpression(id)
+	if err != nil {
+		s.logger.Warn("Failed to cancel expression", zap.String("id", id), zap.Error(err))
+		if errors.Is(err, storage.ErrExpressionFinished) {
+			s.writeError(w, http.StatusConflict, common.ErrExpressionFinished)
+			return
+		}
+		s.writeError(w, http.StatusNotFound, common.ErrExpressionNotFound)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, models.ExpressionResponse{Expression: *expr})
+}
+
+// handleGetExpressionSteps возвращает шаги вычисления выражения, восстановленные
+// по результатам выполненных задач в порядке их завершения.
+func (s *Server) handleGetExpressionSteps(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	expr, err := s.storage.GetExpression(id)
+	if err != nil {
+		s.logger.Warn(common.LogExpressionRetrieved,
+			zap.String("id", id))
+		s.writeError(w, http.StatusNotFound, common.ErrExpressionNotFound)
+		return
+	}
+
+	steps, err := s.expressionSteps(expr)
+	if err != nil {
+		s.logger.Error(common.LogFailedBuildSteps,
+			zap.String("id", id),
+			zap.Error(err))
+		s.writeError(w, http.StatusInternalServerError, common.ErrFailedBuildSteps)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, models.StepsResponse{ID: id, Steps: steps})
+}
+
 // handleGetTask извлекает следующую доступную задачу.
 func (s *Server) handleGetTask(w http.ResponseWriter, _ *http.Request) {
 	task, err := s.storage.GetNextTask()
@@ -124,6 +230,70 @@ func (s *Server) handleGetTask(w http.ResponseWriter, _ *http.Request) {
 	s.writeJSON(w, http.StatusOK, models.TaskResponse{Task: *task})
 }
 
+// handleTaskFailure обрабатывает отказ агента вычислить задачу: выражение переходит
+// в статус ERROR с причиной отказа, а его остальные задачи отменяются.
+func (s *Server) handleTaskFailure(w http.ResponseWriter, result models.TaskResult) {
+	if err := s.storage.FailTask(result.ID, result.LeaseToken, result.Error); err != nil {
+		s.logger.Error(common.LogFailedUpdateTask, zap.String(common.FieldTaskID, result.ID), zap.Error(err))
+		if errors.Is(err, storage.ErrLeaseNotHeld) {
+			s.writeError(w, http.StatusConflict, common.ErrLeaseNotHeld)
+			return
+		}
+		s.writeError(w, http.StatusNotFound, common.ErrTaskNotFound)
+		return
+	}
+
+	s.logger.Warn(common.LogTaskFailed,
+		zap.String(common.FieldTaskID, result.ID),
+		zap.String("reason", result.Error))
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleExtendLease продлевает аренду задачи агентом, который ее держит.
+func (s *Server) handleExtendLease(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	var req models.LeaseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.logger.Error(common.LogFailedDecodeTask, zap.Error(err))
+		s.writeError(w, http.StatusUnprocessableEntity, common.ErrInvalidRequestBody)
+		return
+	}
+
+	if err := s.storage.ExtendLease(id, req.LeaseToken); err != nil {
+		s.logger.Warn(common.LogFailedExtendLease, zap.String(common.FieldTaskID, id), zap.Error(err))
+		s.writeError(w, http.StatusConflict, common.ErrLeaseNotHeld)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleListDeadLetters возвращает задачи, исчерпавшие попытки выполнения.
+func (s *Server) handleListDeadLetters(w http.ResponseWriter, _ *http.Request) {
+	s.writeJSON(w, http.StatusOK, models.DeadLettersResponse{DeadLetters: s.storage.DeadLetters()})
+}
+
+// handleRequeueDeadLetter возвращает недоставленную задачу в очередь.
+func (s *Server) handleRequeueDeadLetter(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if err := s.storage.RequeueDeadLetter(id); err != nil {
+		s.logger.Warn("Failed to requeue dead letter", zap.String(common.FieldTaskID, id), zap.Error(err))
+		if errors.Is(err, storage.ErrExpressionFinished) {
+			s.writeError(w, http.StatusConflict, common.ErrExpressionFinished)
+			return
+		}
+		s.writeError(w, http.StatusNotFound, common.ErrDeadLetterNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleCacheStats возвращает размер кэша результатов задач и число попаданий и промахов.
+func (s *Server) handleCacheStats(w http.ResponseWriter, _ *http.Request) {
+	s.writeJSON(w, http.StatusOK, s.storage.CacheStats())
+}
+
 // handleSubmitTaskResult обрабатывает результат выполненного задания.
 func (s *Server) handleSubmitTaskResult(w http.ResponseWriter, r *http.Request) {
 	var result models.TaskResult
@@ -133,8 +303,17 @@ func (s *Server) handleSubmitTaskResult(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if err := s.storage.UpdateTaskResult(result.ID, result.Result); err != nil {
+	if result.Error != "" {
+		s.handleTaskFailure(w, result)
+		return
+	}
+
+	if err := s.storage.CompleteTask(result.ID, result.LeaseToken, result.Result); err != nil {
 		s.logger.Error(common.LogFailedUpdateTask, zap.String(common.FieldTaskID, result.ID), zap.Error(err))
+		if errors.Is(err, storage.ErrLeaseNotHeld) {
+			s.writeError(w, http.StatusConflict, common.ErrLeaseNotHeld)
+			return
+		}
 		s.writeError(w, http.StatusNotFound, common.ErrTaskNotFound)
 		return
 	}
@@ -146,40 +325,6 @@ func (s *Server) handleSubmitTaskResult(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	dependentTasks := s.storage.GetTasksByDependency(result.ID)
-	for _, depTask := range dependentTasks {
-		depTaskCopy := *depTask
-		allDepsMet := true
-		for _, depID := range depTask.DependsOnTaskIDs {
-			depResult, err := s.storage.GetTaskResult(depID)
-			if err != nil {
-				allDepsMet = false
-				break
-			}
-			if depTask.Arg1 == 0 {
-				depTaskCopy.Arg1 = depResult
-			} else if depTask.Arg2 == 0 {
-				depTaskCopy.Arg2 = depResult
-			}
-		}
-		if allDepsMet && depTaskCopy.Arg1 != 0 && depTaskCopy.Arg2 != 0 {
-			if err := s.storage.SaveTask(&depTaskCopy); err != nil {
-				s.logger.Error("Failed to update dependent task",
-					zap.String(common.FieldTaskID, depTaskCopy.ID),
-					zap.String(common.FieldExpressionID, depTaskCopy.ExpressionID),
-					zap.Error(err))
-
-				// Optionally update the parent expression with an error status
-				if updateErr := s.storage.UpdateExpressionError(task.ExpressionID,
-					"Failed to update dependent task: "+err.Error()); updateErr != nil {
-					s.logger.Error("Failed to update expression error status",
-						zap.String(common.FieldExpressionID, task.ExpressionID),
-						zap.Error(updateErr))
-				}
-			}
-		}
-	}
-
 	allTasks := s.storage.GetTasksByExpressionID(task.ExpressionID)
 	allCompleted := true
 	for _, t := range allTasks {
@@ -189,7 +334,7 @@ func (s *Server) handleSubmitTaskResult(w http.ResponseWriter, r *http.Request)
 		}
 	}
 	if allCompleted {
-		if err := s.storage.UpdateExpressionResult(task.ExpressionID, result.Result); err != nil {
+		if err := s.completeExpression(task.ExpressionID); err != nil {
 			s.logger.Error(common.LogFailedUpdateExpr, zap.String(common.FieldExpressionID, task.ExpressionID), zap.Error(err))
 		}
 	}
@@ -3,6 +3,8 @@ package models
 
 import (
 	"time"
+
+	"github.com/flexer2006/y.lms-sprint2-calculator/pkg/calculation"
 )
 
 // ExpressionStatus представляет собой статус выражения.
@@ -17,34 +19,141 @@ const (
 	StatusComplete ExpressionStatus = "COMPLETE"
 	// StatusError indicates there was an error processing the expression.
 	StatusError ExpressionStatus = "ERROR"
+	// StatusCancelled indicates the expression was cancelled by the user.
+	StatusCancelled ExpressionStatus = "CANCELLED"
+	// StatusTimeout indicates the expression was not calculated before its deadline.
+	StatusTimeout ExpressionStatus = "TIMEOUT"
 )
 
 // Expression представляет собой математическое выражение и его состояние.
 type Expression struct {
 	ID         string           `json:"id"`
 	Expression string           `json:"expression,omitempty"`
+	Notation   string           `json:"notation,omitempty"`
 	Status     ExpressionStatus `json:"status"`
 	Result     *float64         `json:"result,omitempty"`
+	Matrix     [][]float64      `json:"matrix_result,omitempty"`
+	Formatted  string           `json:"formatted_result,omitempty"`
+	Format     *FormatOptions   `json:"-"`
+	Cells      [][]string       `json:"-"` // Идентификаторы задач, вычисляющих ячейки матричного произведения.
+	Plan       []string         `json:"-"` // Выражение в ОПН, где каждая операция заменена идентификатором ее задачи.
+	TimeoutMS  int64            `json:"timeout_ms,omitempty"`
+	Priority   int              `json:"priority,omitempty"`
+	Progress   *Progress        `json:"progress,omitempty"` // Ход вычисления на момент истечения времени.
 	CreatedAt  time.Time        `json:"-"`
 	UpdatedAt  time.Time        `json:"-"`
 	Error      string           `json:"error,omitempty"`
 }
 
+// Progress описывает, сколько задач выражения было выполнено.
+type Progress struct {
+	CompletedTasks int `json:"completed_tasks"`
+	TotalTasks     int `json:"total_tasks"`
+}
+
+// FormatOptions описывает, как форматировать результат выражения.
+type FormatOptions struct {
+	Digits   int    `json:"digits"`
+	Rounding string `json:"rounding,omitempty"`
+	Notation string `json:"notation,omitempty"`
+}
+
+// CalculationOptions converts the request options into calculation.FormatOptions.
+func (f *FormatOptions) CalculationOptions() calculation.FormatOptions {
+	return calculation.FormatOptions{
+		Digits:   f.Digits,
+		Rounding: calculation.RoundingMode(f.Rounding),
+		Notation: calculation.Notation(f.Notation),
+	}
+}
+
+// Подстановки аргументов задачи во фрагменте.
+const (
+	FragmentArg1 = "$1"
+	FragmentArg2 = "$2"
+)
+
 // Task представляет собой вычислительную задачу с двумя аргументами и операцией.
+// Задача с фрагментом вычисляет целое поддерево выражения: Fragment - его запись
+// в ОПН из чисел, операций и подстановок FragmentArg1 и FragmentArg2, вместо которых
+// агент берет значения Arg1 и Arg2. Operation такой задачи - операция корня поддерева.
 type Task struct {
-	ID               string
-	ExpressionID     string
-	Operation        string
-	Arg1             float64
-	Arg2             float64
-	Result           *float64 // nil
-	CreatedAt        time.Time
-	DependsOnTaskIDs []string
+	ID             string    `json:"id"`
+	ExpressionID   string    `json:"expression_id"`
+	Operation      string    `json:"operation"` // Одна из операций + - * / ^ %.
+	Arg1           Operand   `json:"arg1"`
+	Arg2           Operand   `json:"arg2"`
+	Fragment       []string  `json:"fragment,omitempty"`
+	OperationTime  int64     `json:"operation_time,omitempty"`   // Время операции (всех операций фрагмента) в мс; 0 - по конфигурации агента.
+	CriticalPathMS int64     `json:"critical_path_ms,omitempty"` // Время самой долгой цепочки задач от этой задачи до результата выражения.
+	LeaseToken     string    `json:"lease_token,omitempty"`      // Токен аренды выданной агенту задачи.
+	LeaseTimeoutMS int64     `json:"lease_timeout_ms,omitempty"` // Время аренды в мс; агент продлевает ее до истечения.
+	Attempts       int       `json:"attempts,omitempty"`         // Число выдач задачи агентам.
+	Error          string    `json:"error,omitempty"`            // Ошибка, о которой сообщил агент.
+	Result         *float64  `json:"result,omitempty"`           // nil, пока задача не выполнена.
+	CreatedAt      time.Time `json:"created_at"`
+	CompletedAt    time.Time `json:"completed_at"`
+}
+
+// Dependencies возвращает идентификаторы задач, результаты которых служат
+// аргументами задачи, в порядке аргументов.
+func (t *Task) Dependencies() []string {
+	var ids []string
+	for _, arg := range []Operand{t.Arg1, t.Arg2} {
+		if arg.TaskID != "" {
+			ids = append(ids, arg.TaskID)
+		}
+	}
+	return ids
+}
+
+// Operand представляет собой аргумент задачи: число либо ссылку на задачу,
+// результат которой подставляется в Value при выдаче задачи агенту.
+type Operand struct {
+	Value  *float64 `json:"value,omitempty"`
+	TaskID string   `json:"task_id,omitempty"`
+}
+
+// Literal создает аргумент-число.
+func Literal(value float64) Operand {
+	return Operand{Value: &value}
+}
+
+// Ref создает аргумент-ссылку на результат задачи.
+func Ref(taskID string) Operand {
+	return Operand{TaskID: taskID}
+}
+
+// Number возвращает значение аргумента; false означает, что ссылка еще не разрешена.
+func (o Operand) Number() (float64, bool) {
+	if o.Value == nil {
+		return 0, false
+	}
+	return *o.Value, true
 }
 
+// ModeNatural - режим ввода, в котором выражение записано словами на русском
+// или английском языке, например "два плюс два".
+const ModeNatural = "natural"
+
+// Записи выражения во входном запросе.
+const (
+	// NotationInfix - обычная запись с операцией между операндами: "2 + 3 * 4".
+	NotationInfix = "infix"
+	// NotationRPN - обратная польская запись, операция после операндов: "2 3 4 * +".
+	NotationRPN = "rpn"
+	// NotationPrefix - польская запись, операция перед операндами: "+ 2 * 3 4".
+	NotationPrefix = "prefix"
+)
+
 // CalculateRequest представляет собой запрос на вычисление выражения.
 type CalculateRequest struct {
-	Expression string `json:"expression"`
+	Expression string         `json:"expression"`
+	Mode       string         `json:"mode,omitempty"`
+	Notation   string         `json:"notation,omitempty"`
+	Format     *FormatOptions `json:"format,omitempty"`
+	TimeoutMS  int64          `json:"timeout_ms,omitempty"`
+	Priority   int            `json:"priority,omitempty"`
 }
 
 // CalculateResponse представляет собой ответ, содержащий идентификатор вычисления.
@@ -52,10 +161,30 @@ type CalculateResponse struct {
 	ID string `json:"id"`
 }
 
-// TaskResult представляет собой результат вычисления задачи.
+// TaskResult представляет собой результат вычисления задачи или, если задан Error,
+// отказ агента ее вычислить.
 type TaskResult struct {
-	ID     string  `json:"id"`
-	Result float64 `json:"result"`
+	ID         string  `json:"id"`
+	Result     float64 `json:"result"`
+	Error      string  `json:"error,omitempty"` // Причина, по которой агент не смог вычислить задачу.
+	LeaseToken string  `json:"lease_token"`
+}
+
+// DeadLetter представляет собой задачу, исчерпавшую попытки выполнения.
+type DeadLetter struct {
+	Task     Task      `json:"task"`
+	Reason   string    `json:"reason"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// DeadLettersResponse представляет собой ответ, содержащий недоставленные задачи.
+type DeadLettersResponse struct {
+	DeadLetters []DeadLetter `json:"dead_letters"`
+}
+
+// LeaseRequest представляет собой запрос агента на продление аренды задачи.
+type LeaseRequest struct {
+	LeaseToken string `json:"lease_token"`
 }
 
 // ExpressionResponse представляет собой ответ, содержащий одно выражение.
@@ -68,7 +197,22 @@ type ExpressionsResponse struct {
 	Expressions []Expression `json:"expressions"`
 }
 
+// StepsResponse представляет собой ответ, содержащий шаги вычисления выражения.
+type StepsResponse struct {
+	ID    string   `json:"id"`
+	Steps []string `json:"steps"`
+}
+
 // TaskResponse представляет собой ответ, содержащий одно задание.
 type TaskResponse struct {
 	Task Task `json:"task"`
 }
+
+// CacheStats представляет собой состояние кэша результатов задач.
+type CacheStats struct {
+	Enabled  bool   `json:"enabled"`
+	Size     int    `json:"size"`
+	Capacity int    `json:"capacity"`
+	Hits     uint64 `json:"hits"`
+	Misses   uint64 `json:"misses"`
+}
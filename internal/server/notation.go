@@ -0,0 +1,96 @@
+// Package server предоставляет разбор выражений в обратной польской и польской записи.
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/flexer2006/y.lms-sprint2-calculator/common"
+)
+
+// parseRPN разбирает выражение в обратной польской записи, например "2 3 4 * +".
+// Лексемы - числа и операции, разделенные пробелами; отрицательное число
+// записывается слитно: "-3". Возвращает лексемы в порядке, пригодном для planRPN.
+func (s *Server) parseRPN(expression string) ([]string, error) {
+	tokens, err := splitNotation(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	depth := 0
+	for _, token := range tokens {
+		if !isOperator(token) {
+			depth++
+			continue
+		}
+		if depth < 2 {
+			return nil, fmt.Errorf("invalid expression: %s for %q", common.ErrMissingOperand, token)
+		}
+		depth--
+	}
+	if depth != 1 {
+		return nil, fmt.Errorf("invalid expression: too many operands")
+	}
+	return tokens, nil
+}
+
+// parsePrefix разбирает выражение в польской записи, например "+ 2 * 3 4",
+// и переводит его в обратную польскую запись для planRPN.
+func (s *Server) parsePrefix(expression string) ([]string, error) {
+	tokens, err := splitNotation(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	// Справа налево каждая операция забирает два уже собранных операнда.
+	var stack [][]string
+	for i := len(tokens) - 1; i >= 0; i-- {
+		token := tokens[i]
+		if !isOperator(token) {
+			stack = append(stack, []string{token})
+			continue
+		}
+		if len(stack) < 2 {
+			return nil, fmt.Errorf("invalid expression: %s for %q", common.ErrMissingOperand, token)
+		}
+		left, right := stack[len(stack)-1], stack[len(stack)-2]
+		operand := append(append(left, right...), token)
+		stack = append(stack[:len(stack)-2], operand)
+	}
+	if len(stack) != 1 {
+		return nil, fmt.Errorf("invalid expression: too many operands")
+	}
+	return stack[0], nil
+}
+
+// splitNotation делит выражение на лексемы по пробелам и проверяет, что каждая
+// лексема - число или операция.
+func splitNotation(expression string) ([]string, error) {
+	tokens := strings.Fields(expression)
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("invalid expression: empty expression")
+	}
+	for _, token := range tokens {
+		if isOperator(token) {
+			continue
+		}
+		if !isNumberToken(token) {
+			return nil, fmt.Errorf("invalid expression: invalid token %q", token)
+		}
+	}
+	return tokens, nil
+}
+
+// isNumberToken проверяет, что лексема - десятичное число с необязательным минусом.
+// Записи вроде "1e5", "Inf" и "NaN", которые принимает strconv.ParseFloat, отвергаются.
+func isNumberToken(token string) bool {
+	digits := strings.TrimPrefix(token, "-")
+	for i := 0; i < len(digits); i++ {
+		if !isDigit(digits[i]) && digits[i] != '.' {
+			return false
+		}
+	}
+	_, err := strconv.ParseFloat(digits, 64)
+	return err == nil
+}
@@ -2,17 +2,39 @@
 package server
 
 import (
+	"context"
 	"fmt"
+	"github.com/flexer2006/y.lms-sprint2-calculator/common"
 	"github.com/flexer2006/y.lms-sprint2-calculator/internal/server/models"
+	"github.com/flexer2006/y.lms-sprint2-calculator/pkg/calculation"
 	"github.com/google/uuid"
 	"go.uber.org/zap"
+	"sort"
 	"strconv"
 	"strings"
+	"unicode"
 )
 
+// maxSeriesTerms ограничивает число слагаемых или множителей суммы и произведения,
+// распределяемых между агентами.
+const maxSeriesTerms = 10000
+
+// requestLimits ограничивает ресурсы, затрачиваемые на разбор матричных выражений,
+// сумм и произведений из запросов: их разбирает рекурсивный парсер pkg/calculation,
+// а диапазоны и литералы матриц раскрываются целиком еще до планирования.
+var requestLimits = calculation.Limits{
+	MaxDepth:    64,
+	MaxTokens:   20000,
+	MaxLength:   100000,
+	MaxElements: maxSeriesTerms,
+}
+
+// planFunc составляет задачи разобранного выражения и возвращает их вместе с планом.
+type planFunc func(exprID string) ([]*models.Task, []string, error)
+
 // processExpression обрабатывает заданное математическое выражение, составляя задачи.
 func (s *Server) processExpression(expr *models.Expression) error {
-	tokens, err := s.parseExpression(expr.Expression)
+	plan, err := s.parseForPlanning(expr.Expression, expr.Notation)
 	if err != nil {
 		s.logger.Error("Failed to parse expression",
 			zap.String("expression", expr.Expression),
@@ -28,7 +50,12 @@ func (s *Server) processExpression(expr *models.Expression) error {
 		return err
 	}
 
-	tasks, err := s.createTasks(expr.ID, tokens)
+	tasks, rpnPlan, err := plan(expr.ID)
+	if err == nil {
+		tasks, rpnPlan = fuseTasks(tasks, rpnPlan, s.fusionBudget(tasks))
+		setCriticalPaths(tasks)
+		err = s.storage.UpdateExpressionPlan(expr.ID, rpnPlan)
+	}
 	if err != nil {
 		s.logger.Error("Failed to create tasks", zap.Error(err))
 		if updateErr := s.storage.UpdateExpressionError(expr.ID, err.Error()); updateErr != nil {
@@ -43,7 +70,85 @@ func (s *Server) processExpression(expr *models.Expression) error {
 			return err
 		}
 	}
-	return nil
+
+	// Выражение без операций, например сумма из одного слагаемого, уже вычислено,
+	// как и выражение, результаты всех задач которого нашлись в кэше.
+	for _, task := range tasks {
+		if _, err := s.storage.GetTaskResult(task.ID); err != nil {
+			return nil
+		}
+	}
+	return s.completeExpression(expr.ID)
+}
+
+// setCriticalPaths записывает в каждую задачу время самой долгой цепочки задач от нее
+// до результата выражения: ее собственное время и самую долгую цепочку среди
+// зависящих от нее задач. Задачи с большим значением задерживают выражение сильнее
+// и выдаются агентам первыми. Планировщик составляет задачи так, что зависимость
+// идет раньше зависящей от нее задачи, поэтому задачи обходятся с конца.
+func setCriticalPaths(tasks []*models.Task) {
+	longest := make(map[string]int64, len(tasks))
+	for i := len(tasks) - 1; i >= 0; i-- {
+		task := tasks[i]
+		task.CriticalPathMS = task.OperationTime + longest[task.ID]
+		for _, depID := range task.Dependencies() {
+			longest[depID] = max(longest[depID], task.CriticalPathMS)
+		}
+	}
+}
+
+// parseForPlanning разбирает выражение и выбирает способ его распределения между
+// агентами: поячеечное матричное произведение, сумма или произведение с переменной
+// либо обычное числовое выражение. Выражения в обратной польской и польской записи
+// содержат только числа и операции и сразу передаются планировщику.
+func (s *Server) parseForPlanning(expression, notation string) (planFunc, error) {
+	var parse func(string) ([]string, error)
+	switch notation {
+	case "", models.NotationInfix:
+	case models.NotationRPN:
+		parse = s.parseRPN
+	case models.NotationPrefix:
+		parse = s.parsePrefix
+	default:
+		return nil, fmt.Errorf("%s %q", common.ErrUnknownInputNotation, notation)
+	}
+	if parse != nil {
+		rpnTokens, err := parse(expression)
+		if err != nil {
+			return nil, err
+		}
+		return func(exprID string) ([]*models.Task, []string, error) {
+			return s.planRPN(exprID, rpnTokens)
+		}, nil
+	}
+
+	a, b, isMatrix, err := s.parseMatrixProduct(expression)
+	if err != nil {
+		return nil, err
+	}
+	if isMatrix {
+		return func(exprID string) ([]*models.Task, []string, error) {
+			return s.createMatrixTasks(exprID, a, b)
+		}, nil
+	}
+
+	series, isSeries, err := s.parseSeries(expression)
+	if err != nil {
+		return nil, err
+	}
+	if isSeries {
+		return func(exprID string) ([]*models.Task, []string, error) {
+			return s.createSeriesTasks(exprID, series)
+		}, nil
+	}
+
+	tokens, err := s.parseExpression(expression)
+	if err != nil {
+		return nil, err
+	}
+	return func(exprID string) ([]*models.Task, []string, error) {
+		return s.createTasks(exprID, tokens)
+	}, nil
 }
 
 // parseExpression parses a mathematical expression into tokens.
@@ -86,12 +191,11 @@ func (s *Server) parseExpression(expression string) ([]string, error) {
 			continue
 		}
 		if isOperator(string(c)) {
-			if i > 0 && isOperator(string(expression[i-1])) && !(expression[i-1] == '(' && c == '-') {
-				if c == '-' && expression[i-1] == '-' {
-					return nil, fmt.Errorf("invalid expression: invalid structure")
-				}
+			prev := previousNonSpace(expression, i)
+			if c == '-' && prev == '-' {
+				return nil, fmt.Errorf("invalid expression: invalid structure")
 			}
-			if c == '-' && (i == 0 || isOperator(string(expression[i-1])) || expression[i-1] == '(') {
+			if c == '-' && (prev == 0 || isOperator(string(prev)) || prev == '(') {
 				tokens = append(tokens, "-1", "*")
 				continue
 			}
@@ -163,20 +267,173 @@ func (s *Server) parseExpression(expression string) ([]string, error) {
 	return tokens, nil
 }
 
+// parseMatrixProduct распознает выражения, внешняя операция которых - матричное
+// произведение, и возвращает оба множителя. Выражения без матриц (isMatrix == false)
+// разбираются parseSeries и parseExpression.
+func (s *Server) parseMatrixProduct(expression string) (a, b [][]float64, isMatrix bool, err error) {
+	if !strings.Contains(expression, "[") {
+		return nil, nil, false, nil
+	}
+
+	a, b, ok, err := calculation.SplitMatrixProduct(context.Background(), expression, requestLimits)
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("invalid expression: %w", err)
+	}
+	if !ok {
+		return nil, nil, false, fmt.Errorf("invalid expression: %s", common.ErrNotDistributable)
+	}
+	return a, b, true, nil
+}
+
+// parseSeries распознает суммы и произведения с переменной, например
+// sum(i, 1, 100, i^2), и возвращает их члены. Выражения без имен функций
+// (isSeries == false) разбираются parseExpression.
+func (s *Server) parseSeries(expression string) (series calculation.Series, isSeries bool, err error) {
+	if strings.IndexFunc(expression, unicode.IsLetter) < 0 {
+		return calculation.Series{}, false, nil
+	}
+
+	series, ok, err := calculation.SplitSeries(context.Background(), expression, requestLimits)
+	if err != nil {
+		return calculation.Series{}, false, fmt.Errorf("invalid expression: %w", err)
+	}
+	if !ok {
+		return calculation.Series{}, false, fmt.Errorf("invalid expression: %s", common.ErrNotDistributable)
+	}
+	return series, true, nil
+}
+
+// createSeriesTasks создает задачи суммы или произведения: члены вычисляются
+// независимо друг от друга, затем их результаты попарно сворачиваются операцией ряда.
+// Пустая сумма равна 0, пустое произведение - 1.
+func (s *Server) createSeriesTasks(exprID string, series calculation.Series) ([]*models.Task, []string, error) {
+	if len(series.Terms) == 0 {
+		identity := "0"
+		if series.Op == "*" {
+			identity = "1"
+		}
+		return s.planRPN(exprID, []string{identity})
+	}
+
+	for _, term := range series.Terms {
+		for _, token := range term {
+			if _, err := strconv.ParseFloat(token, 64); err != nil && !isOperator(token) {
+				return nil, nil, fmt.Errorf("invalid RPN expression: unexpected token %q", token)
+			}
+		}
+	}
+	return s.planRPN(exprID, reduceTerms(series.Terms, series.Op))
+}
+
+// reduceTerms объединяет члены ряда в одно выражение в обратной польской нотации,
+// сворачивая их сбалансированным деревом: глубина зависимостей задач растет
+// логарифмически от числа членов.
+func reduceTerms(terms [][]string, op string) []string {
+	if len(terms) == 1 {
+		return terms[0]
+	}
+	middle := len(terms) / 2
+	rpnTokens := append(reduceTerms(terms[:middle], op), reduceTerms(terms[middle:], op)...)
+	return append(rpnTokens, op)
+}
+
+// createMatrixTasks создает задачи матричного произведения a·b: каждая ячейка
+// результата вычисляется независимой цепочкой умножений и сложений.
+// План содержит планы ячеек подряд, по строкам.
+func (s *Server) createMatrixTasks(exprID string, a, b [][]float64) ([]*models.Task, []string, error) {
+	var (
+		tasks []*models.Task
+		plan  []string
+	)
+	cells := make([][]string, len(a))
+
+	for i := range a {
+		cells[i] = make([]string, len(b[0]))
+		for j := range b[0] {
+			var rpnTokens []string
+			for k := range b {
+				rpnTokens = append(rpnTokens,
+					strconv.FormatFloat(a[i][k], 'g', -1, 64),
+					strconv.FormatFloat(b[k][j], 'g', -1, 64),
+					"*")
+				if k > 0 {
+					rpnTokens = append(rpnTokens, "+")
+				}
+			}
+
+			cellTasks, cellPlan, err := s.planRPN(exprID, rpnTokens)
+			if err != nil {
+				return nil, nil, err
+			}
+			cells[i][j] = cellTasks[len(cellTasks)-1].ID
+			tasks = append(tasks, cellTasks...)
+			plan = append(plan, cellPlan...)
+		}
+	}
+
+	if err := s.storage.UpdateExpressionCells(exprID, cells); err != nil {
+		return nil, nil, err
+	}
+	return tasks, plan, nil
+}
+
+// completeExpression сохраняет результат выражения, все задачи которого выполнены.
+// Результат - последняя лексема плана: число или результат корневой задачи.
+// Результат матричного произведения собирается из результатов задач-ячеек.
+func (s *Server) completeExpression(exprID string) error {
+	expr, err := s.storage.GetExpression(exprID)
+	if err != nil {
+		return err
+	}
+	if expr.Cells == nil {
+		root := expr.Plan[len(expr.Plan)-1]
+		result, err := strconv.ParseFloat(root, 64)
+		if err != nil {
+			if result, err = s.storage.GetTaskResult(root); err != nil {
+				return err
+			}
+		}
+		return s.storage.UpdateExpressionResult(exprID, result)
+	}
+
+	matrix := make([][]float64, len(expr.Cells))
+	for i, row := range expr.Cells {
+		matrix[i] = make([]float64, len(row))
+		for j, taskID := range row {
+			value, err := s.storage.GetTaskResult(taskID)
+			if err != nil {
+				return err
+			}
+			matrix[i][j] = value
+		}
+	}
+	return s.storage.UpdateExpressionMatrixResult(exprID, matrix)
+}
+
 // createTasks создает вычислительные задачи из лексем выражения.
-func (s *Server) createTasks(exprID string, tokens []string) ([]*models.Task, error) {
+func (s *Server) createTasks(exprID string, tokens []string) ([]*models.Task, []string, error) {
 	rpnTokens, err := s.toRPN(tokens)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+	return s.planRPN(exprID, rpnTokens)
+}
 
+// planRPN создает вычислительные задачи из выражения в обратной польской нотации.
+// Последняя задача вычисляет значение всего выражения. Одинаковые поддеревья
+// вычисляются одной задачей, результат которой получают все зависящие от нее задачи.
+// Вместе с задачами возвращается план - те же лексемы, где каждая операция заменена
+// идентификатором задачи.
+func (s *Server) planRPN(exprID string, rpnTokens []string) ([]*models.Task, []string, error) {
 	var tasks []*models.Task
 	var stack []interface{}
+	plan := make([]string, 0, len(rpnTokens))
+	shared := make(map[string]string) // Ключ поддерева -> идентификатор задачи.
 
 	for _, token := range rpnTokens {
 		if isOperator(token) {
 			if len(stack) < 2 {
-				return nil, fmt.Errorf("invalid RPN expression: too few operands")
+				return nil, nil, fmt.Errorf("invalid RPN expression: too few operands")
 			}
 
 			op2 := stack[len(stack)-1]
@@ -184,40 +441,181 @@ func (s *Server) createTasks(exprID string, tokens []string) ([]*models.Task, er
 			op1 := stack[len(stack)-1]
 			stack = stack[:len(stack)-1]
 
-			task := &models.Task{
-				ID:           uuid.New().String(),
-				ExpressionID: exprID,
-				Operation:    token,
+			key := subtreeKey(token, op1, op2)
+			if taskID, ok := shared[key]; ok {
+				stack = append(stack, taskID)
+				plan = append(plan, taskID)
+				continue
 			}
 
-			_ = s.getOperationTime(token)
-
-			switch v := op1.(type) {
-			case float64:
-				task.Arg1 = v
-			case string:
-				task.DependsOnTaskIDs = append(task.DependsOnTaskIDs, v)
-			}
-			switch v := op2.(type) {
-			case float64:
-				task.Arg2 = v
-			case string:
-				task.DependsOnTaskIDs = append(task.DependsOnTaskIDs, v)
+			task := &models.Task{
+				ID:            uuid.New().String(),
+				ExpressionID:  exprID,
+				Operation:     token,
+				OperationTime: s.getOperationTime(token),
 			}
 
+			task.Arg1 = operand(op1)
+			task.Arg2 = operand(op2)
+
+			shared[key] = task.ID
 			tasks = append(tasks, task)
 			stack = append(stack, task.ID)
+			plan = append(plan, task.ID)
 		} else {
 			num, _ := strconv.ParseFloat(token, 64)
 			stack = append(stack, num)
+			plan = append(plan, token)
 		}
 	}
 
 	if len(stack) != 1 {
-		return nil, fmt.Errorf("invalid RPN expression: too many operands")
+		return nil, nil, fmt.Errorf("invalid RPN expression: too many operands")
 	}
 
-	return tasks, nil
+	return tasks, plan, nil
+}
+
+// subtreeKey строит структурный ключ поддерева из операции и ключей операндов.
+// Операнды-задачи уже разделены между одинаковыми поддеревьями, поэтому их
+// идентификатор однозначно описывает поддерево. Операнды сложения и умножения
+// упорядочиваются: a+b и b+a вычисляются одной задачей.
+func subtreeKey(op string, op1, op2 interface{}) string {
+	key1, key2 := operandKey(op1), operandKey(op2)
+	if (op == "+" || op == "*") && key2 < key1 {
+		key1, key2 = key2, key1
+	}
+	return op + " " + key1 + " " + key2
+}
+
+// operandKey возвращает ключ элемента стека планировщика.
+func operandKey(v interface{}) string {
+	if taskID, ok := v.(string); ok {
+		return "#" + taskID
+	}
+	return strconv.FormatFloat(v.(float64), 'g', -1, 64)
+}
+
+// operand превращает элемент стека планировщика - число или идентификатор задачи -
+// в аргумент задачи.
+func operand(v interface{}) models.Operand {
+	if taskID, ok := v.(string); ok {
+		return models.Ref(taskID)
+	}
+	return models.Literal(v.(float64))
+}
+
+// expressionSteps восстанавливает шаги вычисления выражения: первый шаг - выражение
+// целиком, каждый следующий заменяет поддерево одной выполненной задачи ее результатом.
+// Задачи применяются в порядке завершения.
+func (s *Server) expressionSteps(expr *models.Expression) ([]string, error) {
+	steps := []string{}
+	if len(expr.Plan) == 0 {
+		return steps, nil
+	}
+
+	var completed []*models.Task
+	operations := make(map[string]string)
+	for _, token := range expr.Plan {
+		if _, err := strconv.ParseFloat(token, 64); err == nil || isOperator(token) {
+			continue
+		}
+		if _, ok := operations[token]; ok {
+			continue
+		}
+		task, err := s.storage.GetTask(token)
+		if err != nil {
+			return nil, err
+		}
+		operations[task.ID] = task.Operation
+		if task.Result != nil {
+			completed = append(completed, task)
+		}
+	}
+	sort.SliceStable(completed, func(i, j int) bool {
+		return completed[i].CompletedAt.Before(completed[j].CompletedAt)
+	})
+
+	plan := append([]string(nil), expr.Plan...)
+	for i := 0; i <= len(completed); i++ {
+		if i > 0 {
+			plan = replaceSubtree(plan, completed[i-1].ID, *completed[i-1].Result)
+		}
+
+		step, err := formatPlan(plan, operations, expr.Cells)
+		if err != nil {
+			return nil, err
+		}
+		if len(steps) == 0 || steps[len(steps)-1] != step {
+			steps = append(steps, step)
+		}
+	}
+	return steps, nil
+}
+
+// replaceSubtree заменяет в плане поддерево задачи taskID ее результатом. Общая
+// задача может встречаться в плане несколько раз - заменяются все вхождения.
+// Если задача уже вошла в замененное поддерево, план не меняется.
+func replaceSubtree(plan []string, taskID string, result float64) []string {
+	for {
+		end := -1
+		for i, token := range plan {
+			if token == taskID {
+				end = i
+				break
+			}
+		}
+		if end < 0 {
+			return plan
+		}
+
+		start, need := end, 2
+		for need > 0 {
+			start--
+			if _, err := strconv.ParseFloat(plan[start], 64); err == nil {
+				need--
+			} else {
+				need++
+			}
+		}
+
+		replaced := append([]string(nil), plan[:start]...)
+		replaced = append(replaced, strconv.FormatFloat(result, 'g', -1, 64))
+		plan = append(replaced, plan[end+1:]...)
+	}
+}
+
+// formatPlan печатает план в инфиксной записи, подставляя операции задач.
+// План матричного произведения печатается как матрица выражений ячеек.
+func formatPlan(plan []string, operations map[string]string, cells [][]string) (string, error) {
+	rpnTokens := make([]string, len(plan))
+	for i, token := range plan {
+		rpnTokens[i] = token
+		if op, ok := operations[token]; ok {
+			rpnTokens[i] = op
+		}
+	}
+
+	expressions, err := calculation.FormatRPN(rpnTokens)
+	if err != nil {
+		return "", err
+	}
+	if cells == nil {
+		if len(expressions) != 1 {
+			return "", fmt.Errorf("invalid RPN expression: too many operands")
+		}
+		return expressions[0], nil
+	}
+
+	rows := make([]string, len(cells))
+	for i, row := range cells {
+		if len(expressions) < len(row) {
+			return "", fmt.Errorf("invalid RPN expression: too few operands")
+		}
+		rows[i] = "[" + strings.Join(expressions[:len(row)], ", ") + "]"
+		expressions = expressions[len(row):]
+	}
+	return "[" + strings.Join(rows, ", ") + "]", nil
 }
 
 // getOperationTime returns the time required for a specific operation.
@@ -231,6 +629,10 @@ func (s *Server) getOperationTime(op string) int64 {
 		return s.config.TimeMultiplyMS
 	case "/":
 		return s.config.TimeDivisionMS
+	case "^":
+		return s.config.TimePowerMS
+	case "%":
+		return s.config.TimeModuloMS
 	default:
 		return 100
 	}
@@ -239,33 +641,98 @@ func (s *Server) getOperationTime(op string) int64 {
 // isOperator checks if a token is a valid operator.
 func isOperator(token string) bool {
 	switch token {
-	case "+", "-", "*", "/":
+	case "+", "-", "*", "/", "^", "%":
 		return true
 	default:
 		return false
 	}
 }
 
+// previousNonSpace возвращает последний непробельный символ expression перед
+// позицией i или 0, если его нет. По нему parseExpression отличает унарный минус
+// от бинарного независимо от пробелов: 2 * -3 - то же, что 2*-3.
+func previousNonSpace(expression string, i int) byte {
+	for j := i - 1; j >= 0; j-- {
+		if expression[j] != ' ' {
+			return expression[j]
+		}
+	}
+	return 0
+}
+
 // isDigit checks if a byte is a digit.
 func isDigit(c byte) bool {
 	return c >= '0' && c <= '9'
 }
 
-// toRPN преобразует маркеры инфиксной нотации в обратную польскую нотацию
+// operatorInfo описывает приоритет и ассоциативность операции.
+type operatorInfo struct {
+	precedence int  // Чем больше, тем раньше выполняется операция.
+	rightAssoc bool // Операции одного приоритета выполняются справа налево.
+}
+
+// negation обозначает унарный минус в стеке операций toRPN.
+const negation = "neg"
+
+// operators задает приоритеты операций инфиксной записи, как в pkg/calculation.
+// Унарный минус связывает сильнее умножения и деления, но слабее степени:
+// 2/-3 - это 2/(-3), а -2^2 - это -(2^2). Степень правоассоциативна: 2^3^2 - это 2^(3^2).
+var operators = map[string]operatorInfo{
+	"+":      {precedence: 1},
+	"-":      {precedence: 1},
+	"*":      {precedence: 2},
+	"/":      {precedence: 2},
+	"%":      {precedence: 2},
+	negation: {precedence: 3},
+	"^":      {precedence: 4, rightAssoc: true},
+}
+
+// toRPN преобразует лексемы инфиксной записи в обратную польскую запись
+// алгоритмом сортировочной станции с учетом приоритетов, ассоциативности,
+// скобок и унарного минуса.
 func (s *Server) toRPN(tokens []string) ([]string, error) {
 	var stack []string
 	var output []string
 
-	for _, token := range tokens {
-		if isOperator(token) {
+	// pop переносит операцию с вершины стека в выходную последовательность.
+	pop := func() {
+		op := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if op == negation {
+			op = "*"
+		}
+		output = append(output, op)
+	}
 
-			for len(stack) > 0 && isOperator(stack[len(stack)-1]) {
-				output = append(output, stack[len(stack)-1])
-				stack = stack[:len(stack)-1]
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		switch {
+		case isNegation(tokens, i):
+			// Множитель -1 выводится сразу, а умножение откладывается до конца операнда.
+			output = append(output, "-1")
+			stack = append(stack, negation)
+			i++
+		case token == "(":
+			stack = append(stack, token)
+		case token == ")":
+			for len(stack) > 0 && stack[len(stack)-1] != "(" {
+				pop()
+			}
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("invalid expression: unmatched parentheses")
+			}
+			stack = stack[:len(stack)-1]
+		case isOperator(token):
+			current := operators[token]
+			for len(stack) > 0 && stack[len(stack)-1] != "(" {
+				top := operators[stack[len(stack)-1]]
+				if top.precedence < current.precedence || top.precedence == current.precedence && current.rightAssoc {
+					break
+				}
+				pop()
 			}
 			stack = append(stack, token)
-		} else {
-
+		default:
 			if _, err := strconv.ParseFloat(token, 64); err != nil {
 				return nil, fmt.Errorf("invalid number: %s", token)
 			}
@@ -274,9 +741,18 @@ func (s *Server) toRPN(tokens []string) ([]string, error) {
 	}
 
 	for len(stack) > 0 {
-		output = append(output, stack[len(stack)-1])
-		stack = stack[:len(stack)-1]
+		if stack[len(stack)-1] == "(" {
+			return nil, fmt.Errorf("invalid expression: unmatched parentheses")
+		}
+		pop()
 	}
 
 	return output, nil
 }
+
+// isNegation сообщает, начинается ли с tokens[i] унарный минус. parseExpression
+// записывает его как пару "-1", "*"; число -1 не может прийти из ввода иначе,
+// потому что числа в выражении не содержат знака.
+func isNegation(tokens []string, i int) bool {
+	return tokens[i] == "-1" && i+1 < len(tokens) && tokens[i+1] == "*"
+}
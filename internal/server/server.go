@@ -26,10 +26,14 @@ type Server struct {
 
 // New creates a new Server instance with the provided configuration and logger.
 func New(cfg *configs.ServerConfig, log *logger.Logger) *Server {
+	cacheTTL := time.Duration(cfg.ResultCacheTTLMS) * time.Millisecond
 	s := &Server{
-		config:  cfg,
-		storage: storage.New(log.Logger),
-		logger:  log,
+		config: cfg,
+		storage: storage.New(log.Logger,
+			storage.WithResultCache(int(cfg.ResultCacheSize), cacheTTL),
+			storage.WithLeaseTimeout(time.Duration(cfg.LeaseTimeoutMS)*time.Millisecond),
+			storage.WithRetryPolicy(int(cfg.MaxAttempts), time.Duration(cfg.RetryBackoffMS)*time.Millisecond)),
+		logger: log,
 	}
 
 	router := mux.NewRouter()
@@ -38,10 +42,16 @@ func New(cfg *configs.ServerConfig, log *logger.Logger) *Server {
 	api.HandleFunc("/calculate", s.handleCalculate).Methods(http.MethodPost)
 	api.HandleFunc("/expressions", s.handleListExpressions).Methods(http.MethodGet)
 	api.HandleFunc("/expressions/{id}", s.handleGetExpression).Methods(http.MethodGet)
+	api.HandleFunc("/expressions/{id}", s.handleCancelExpression).Methods(http.MethodDelete)
+	api.HandleFunc("/expressions/{id}/steps", s.handleGetExpressionSteps).Methods(http.MethodGet)
 
 	internal := router.PathPrefix("/internal").Subrouter()
 	internal.HandleFunc(common.PathTask, s.handleGetTask).Methods(http.MethodGet)
 	internal.HandleFunc(common.PathTask, s.handleSubmitTaskResult).Methods(http.MethodPost)
+	internal.HandleFunc(common.PathTaskLease, s.handleExtendLease).Methods(http.MethodPost)
+	internal.HandleFunc(common.PathDeadLetters, s.handleListDeadLetters).Methods(http.MethodGet)
+	internal.HandleFunc(common.PathDeadLetterRequeue, s.handleRequeueDeadLetter).Methods(http.MethodPost)
+	internal.HandleFunc(common.PathCache, s.handleCacheStats).Methods(http.MethodGet)
 
 	web := router.PathPrefix("/web").Subrouter()
 	web.HandleFunc("/calculate", s.handleWebCalculatePage)
@@ -67,7 +77,17 @@ func New(cfg *configs.ServerConfig, log *logger.Logger) *Server {
 		zap.Int64("timeAdditionMS", cfg.TimeAdditionMS),
 		zap.Int64("timeSubtractionMS", cfg.TimeSubtractionMS),
 		zap.Int64("timeMultiplyMS", cfg.TimeMultiplyMS),
-		zap.Int64("timeDivisionMS", cfg.TimeDivisionMS))
+		zap.Int64("timeDivisionMS", cfg.TimeDivisionMS),
+		zap.Int64("timePowerMS", cfg.TimePowerMS),
+		zap.Int64("timeModuloMS", cfg.TimeModuloMS),
+		zap.Int64("resultCacheSize", cfg.ResultCacheSize),
+		zap.Int64("resultCacheTTLMS", cfg.ResultCacheTTLMS),
+		zap.Int64("leaseTimeoutMS", cfg.LeaseTimeoutMS),
+		zap.Int64("maxAttempts", cfg.MaxAttempts),
+		zap.Int64("retryBackoffMS", cfg.RetryBackoffMS),
+		zap.Int64("defaultTimeoutMS", cfg.DefaultTimeoutMS),
+		zap.Int64("maxTimeoutMS", cfg.MaxTimeoutMS),
+		zap.Int64("computingPower", cfg.ComputingPower))
 
 	return s
 }
@@ -0,0 +1,154 @@
+// Package storage предоставляет кэш результатов задач, общий для всех выражений.
+package storage
+
+import (
+	"container/list"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/flexer2006/y.lms-sprint2-calculator/internal/server/models"
+)
+
+// Option настраивает Storage при создании.
+type Option func(*Storage)
+
+// WithResultCache включает кэш результатов задач: задача, уже вычисленная для любого
+// выражения, выполняется сразу, без отправки агенту. Кэш хранит не более size
+// результатов, каждый не дольше ttl; size <= 0 отключает кэш, ttl <= 0 снимает
+// ограничение по времени.
+func WithResultCache(size int, ttl time.Duration) Option {
+	return func(s *Storage) {
+		if size > 0 {
+			s.cache = newResultCache(size, ttl)
+		}
+	}
+}
+
+// CacheStats возвращает размер кэша результатов и число попаданий и промахов.
+func (s *Storage) CacheStats() models.CacheStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cache == nil {
+		return models.CacheStats{}
+	}
+	return models.CacheStats{
+		Enabled:  true,
+		Size:     s.cache.order.Len(),
+		Capacity: s.cache.capacity,
+		Hits:     s.cache.hits,
+		Misses:   s.cache.misses,
+	}
+}
+
+// resultCache - LRU-кэш результатов задач с ограничением времени жизни записей.
+// Доступ к нему защищен Storage.mu.
+type resultCache struct {
+	capacity int
+	ttl      time.Duration
+	entries  map[string]*list.Element
+	order    *list.List // Начало списка - последние использованные записи.
+	hits     uint64
+	misses   uint64
+	now      func() time.Time
+}
+
+// cacheEntry - запись кэша результатов.
+type cacheEntry struct {
+	key     string
+	result  float64
+	expires time.Time
+}
+
+// newResultCache создает кэш на capacity записей с временем жизни ttl.
+func newResultCache(capacity int, ttl time.Duration) *resultCache {
+	return &resultCache{
+		capacity: capacity,
+		ttl:      ttl,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+		now:      time.Now,
+	}
+}
+
+// get возвращает результат по ключу. Устаревшая запись удаляется и считается промахом.
+func (c *resultCache) get(key string) (float64, bool) {
+	elem, ok := c.entries[key]
+	if ok && c.ttl > 0 && c.now().After(elem.Value.(*cacheEntry).expires) {
+		c.remove(elem)
+		ok = false
+	}
+	if !ok {
+		c.misses++
+		return 0, false
+	}
+	c.hits++
+	c.order.MoveToFront(elem)
+	return elem.Value.(*cacheEntry).result, true
+}
+
+// put сохраняет результат, вытесняя давно не использованную запись при переполнении.
+func (c *resultCache) put(key string, result float64) {
+	expires := c.now().Add(c.ttl)
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*cacheEntry)
+		entry.result, entry.expires = result, expires
+		c.order.MoveToFront(elem)
+		return
+	}
+	if c.order.Len() >= c.capacity {
+		c.remove(c.order.Back())
+	}
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, result: result, expires: expires})
+}
+
+// remove удаляет запись из кэша.
+func (c *resultCache) remove(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.entries, elem.Value.(*cacheEntry).key)
+}
+
+// taskKey строит канонический вид задачи: операцию и значения аргументов. Аргументы
+// сложения и умножения упорядочиваются, чтобы 2+3 и 3+2 имели один ключ.
+// Ключ задачи с фрагментом - фрагмент с подставленными значениями аргументов.
+// Задача с неразрешенным аргументом ключа не имеет.
+func taskKey(task *models.Task) (string, bool) {
+	if len(task.Fragment) > 0 {
+		return fragmentKey(task)
+	}
+
+	arg1, ok1 := task.Arg1.Number()
+	arg2, ok2 := task.Arg2.Number()
+	if !ok1 || !ok2 {
+		return "", false
+	}
+	if (task.Operation == "+" || task.Operation == "*") && arg2 < arg1 {
+		arg1, arg2 = arg2, arg1
+	}
+	return task.Operation + " " + strconv.FormatFloat(arg1, 'g', -1, 64) +
+		" " + strconv.FormatFloat(arg2, 'g', -1, 64), true
+}
+
+// fragmentKey строит ключ задачи с фрагментом.
+func fragmentKey(task *models.Task) (string, bool) {
+	tokens := make([]string, len(task.Fragment))
+	for i, token := range task.Fragment {
+		var arg models.Operand
+		switch token {
+		case models.FragmentArg1:
+			arg = task.Arg1
+		case models.FragmentArg2:
+			arg = task.Arg2
+		default:
+			tokens[i] = token
+			continue
+		}
+		value, resolved := arg.Number()
+		if !resolved {
+			return "", false
+		}
+		tokens[i] = strconv.FormatFloat(value, 'g', -1, 64)
+	}
+	return strings.Join(tokens, " "), true
+}
@@ -0,0 +1,52 @@
+// Package storage предоставляет ограничение времени вычисления выражений.
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/flexer2006/y.lms-sprint2-calculator/common"
+
+	"go.uber.org/zap"
+)
+
+// ExpireAfter прерывает выражение по TimeoutExpression, если оно не будет вычислено
+// за timeoutMS миллисекунд. Таймер останавливается, как только выражение вычислено,
+// отменено или завершилось ошибкой.
+func (s *Storage) ExpireAfter(id string, timeoutMS int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.armDeadline(id, time.Duration(timeoutMS)*time.Millisecond, timeoutMS)
+}
+
+// armDeadline запускает таймер, который через delay прерывает выражение с причиной,
+// указывающей время timeoutMS. Вызывающий должен держать s.mu.
+func (s *Storage) armDeadline(id string, delay time.Duration, timeoutMS int64) {
+	s.stopDeadline(id)
+	s.deadlines[id] = time.AfterFunc(delay, func() {
+		err := s.TimeoutExpression(id, fmt.Sprintf(common.ErrExpressionTimeout, timeoutMS))
+		if err != nil && !errors.Is(err, ErrExpressionFinished) {
+			s.logger.Error("Failed to time out expression", zap.String(common.FieldID, id), zap.Error(err))
+		}
+	})
+}
+
+// rearmDeadline снова запускает таймер выражения, возобновленного после ошибки:
+// выражению остается время до первоначального срока. Вызывающий должен держать s.mu.
+func (s *Storage) rearmDeadline(id string, createdAt time.Time, timeoutMS int64) {
+	if timeoutMS <= 0 {
+		return
+	}
+	remaining := time.Duration(timeoutMS)*time.Millisecond - s.now().Sub(createdAt)
+	s.armDeadline(id, max(remaining, 0), timeoutMS)
+}
+
+// stopDeadline останавливает таймер выражения, если он есть. Вызывающий должен держать s.mu.
+func (s *Storage) stopDeadline(id string) {
+	if timer, ok := s.deadlines[id]; ok {
+		timer.Stop()
+		delete(s.deadlines, id)
+	}
+}
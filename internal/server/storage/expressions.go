@@ -2,15 +2,20 @@
 package storage
 
 import (
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/flexer2006/y.lms-sprint2-calculator/common"
 	"github.com/flexer2006/y.lms-sprint2-calculator/internal/server/models"
+	"github.com/flexer2006/y.lms-sprint2-calculator/pkg/calculation"
 
 	"go.uber.org/zap"
 )
 
+// ErrExpressionFinished возвращается при попытке отменить уже завершенное выражение.
+var ErrExpressionFinished = errors.New(common.ErrExpressionFinished)
+
 // SaveExpression сохраняет выражение в памяти.
 func (s *Storage) SaveExpression(expr *models.Expression) error {
 	if expr.ID == "" {
@@ -18,7 +23,7 @@ func (s *Storage) SaveExpression(expr *models.Expression) error {
 		return fmt.Errorf("expression ID cannot be empty")
 	}
 
-	now := time.Now()
+	now := s.now()
 	if expr.CreatedAt.IsZero() {
 		expr.CreatedAt = now
 	}
@@ -67,7 +72,10 @@ func (s *Storage) UpdateExpressionStatus(id string, status models.ExpressionStat
 
 		updated := *expr
 		updated.Status = status
-		updated.UpdatedAt = time.Now().Add(time.Millisecond)
+		updated.UpdatedAt = s.now().Add(time.Millisecond)
+		if status != models.StatusProgress {
+			s.stopDeadline(id)
+		}
 
 		s.expressions.Store(id, &updated)
 		s.logger.Info(common.LogExpressionStatusUpdated,
@@ -82,14 +90,92 @@ func (s *Storage) UpdateExpressionStatus(id string, status models.ExpressionStat
 }
 
 // UpdateExpressionResult обновляет результат выражения в хранилище.
+// Отмененное или прерванное по времени выражение не изменяется.
 func (s *Storage) UpdateExpressionResult(id string, result float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	if value, ok := s.expressions.Load(id); ok {
 		expr := value.(*models.Expression)
+		if isStopped(expr.Status) {
+			return nil
+		}
 
 		updated := *expr
 		updated.Result = &result
 		updated.Status = models.StatusComplete
-		updated.UpdatedAt = time.Now()
+		updated.UpdatedAt = s.now()
+		s.stopDeadline(id)
+
+		if expr.Format != nil {
+			formatted, err := calculation.Format(result, expr.Format.CalculationOptions())
+			if err != nil {
+				s.logger.Error(common.LogFailedFormatResult,
+					zap.String(common.FieldID, id),
+					zap.Error(err))
+			}
+			updated.Formatted = formatted
+		}
+
+		s.expressions.Store(id, &updated)
+		return nil
+	}
+	return fmt.Errorf("expression not found")
+}
+
+// UpdateExpressionCells запоминает задачи, вычисляющие ячейки матричного произведения.
+func (s *Storage) UpdateExpressionCells(id string, cells [][]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if value, ok := s.expressions.Load(id); ok {
+		expr := value.(*models.Expression)
+
+		updated := *expr
+		updated.Cells = cells
+		updated.UpdatedAt = s.now()
+
+		s.expressions.Store(id, &updated)
+		return nil
+	}
+	return fmt.Errorf("expression not found")
+}
+
+// UpdateExpressionPlan запоминает план вычисления выражения для восстановления его шагов.
+func (s *Storage) UpdateExpressionPlan(id string, plan []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if value, ok := s.expressions.Load(id); ok {
+		expr := value.(*models.Expression)
+
+		updated := *expr
+		updated.Plan = plan
+		updated.UpdatedAt = s.now()
+
+		s.expressions.Store(id, &updated)
+		return nil
+	}
+	return fmt.Errorf("expression not found")
+}
+
+// UpdateExpressionMatrixResult обновляет матричный результат выражения в хранилище.
+// Отмененное или прерванное по времени выражение не изменяется.
+func (s *Storage) UpdateExpressionMatrixResult(id string, result [][]float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if value, ok := s.expressions.Load(id); ok {
+		expr := value.(*models.Expression)
+		if isStopped(expr.Status) {
+			return nil
+		}
+
+		updated := *expr
+		updated.Matrix = result
+		updated.Status = models.StatusComplete
+		updated.UpdatedAt = s.now()
+		s.stopDeadline(id)
 
 		s.expressions.Store(id, &updated)
 		return nil
@@ -98,14 +184,28 @@ func (s *Storage) UpdateExpressionResult(id string, result float64) error {
 }
 
 // UpdateExpressionError обновляет ошибку выражения в хранилище.
+// Отмененное или прерванное по времени выражение не изменяется.
 func (s *Storage) UpdateExpressionError(id string, err string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.expressionError(id, err)
+}
+
+// expressionError переводит выражение в статус ERROR с ошибкой err.
+// Вызывающий должен держать s.mu.
+func (s *Storage) expressionError(id string, err string) error {
 	if value, ok := s.expressions.Load(id); ok {
 		expr := value.(*models.Expression)
+		if isStopped(expr.Status) {
+			return nil
+		}
 
 		updated := *expr
 		updated.Error = err
 		updated.Status = models.StatusError
-		updated.UpdatedAt = time.Now()
+		updated.UpdatedAt = s.now()
+		s.stopDeadline(id)
 
 		s.expressions.Store(id, &updated)
 		return nil
@@ -113,6 +213,78 @@ func (s *Storage) UpdateExpressionError(id string, err string) error {
 	return fmt.Errorf("expression not found")
 }
 
+// CancelExpression отменяет незавершенное выражение: его задачи убираются из очереди
+// и списка недоставленных, а результаты, которые агенты пришлют позже, отклоняются.
+func (s *Storage) CancelExpression(id string) (*models.Expression, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	value, ok := s.expressions.Load(id)
+	if !ok {
+		return nil, fmt.Errorf("expression not found")
+	}
+	expr := value.(*models.Expression)
+	if !isValidStatusTransition(expr.Status, models.StatusCancelled) {
+		return nil, fmt.Errorf(common.ErrFormatWithWrap, id, ErrExpressionFinished)
+	}
+
+	s.cancelExpression(id)
+	s.stopDeadline(id)
+
+	updated := *expr
+	updated.Status = models.StatusCancelled
+	updated.UpdatedAt = s.now()
+	s.expressions.Store(id, &updated)
+
+	s.logger.Info(common.LogExpressionCancelled,
+		zap.String(common.FieldID, id),
+		zap.String(common.FieldOldStatus, string(expr.Status)))
+	return &updated, nil
+}
+
+// TimeoutExpression прерывает незавершенное выражение, время вычисления которого
+// истекло: его задачи отменяются, как при CancelExpression, а выражение переходит
+// в статус TIMEOUT с причиной reason и числом выполненных к этому моменту задач.
+func (s *Storage) TimeoutExpression(id, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	value, ok := s.expressions.Load(id)
+	if !ok {
+		return fmt.Errorf("expression not found")
+	}
+	expr := value.(*models.Expression)
+	if !isValidStatusTransition(expr.Status, models.StatusTimeout) {
+		return fmt.Errorf(common.ErrFormatWithWrap, id, ErrExpressionFinished)
+	}
+
+	progress := models.Progress{}
+	s.tasks.Range(func(_, v interface{}) bool {
+		if task := v.(*models.Task); task.ExpressionID == id {
+			progress.TotalTasks++
+			if task.Result != nil {
+				progress.CompletedTasks++
+			}
+		}
+		return true
+	})
+	s.cancelExpression(id)
+	s.stopDeadline(id)
+
+	updated := *expr
+	updated.Status = models.StatusTimeout
+	updated.Error = reason
+	updated.Progress = &progress
+	updated.UpdatedAt = s.now()
+	s.expressions.Store(id, &updated)
+
+	s.logger.Warn(common.LogExpressionTimedOut,
+		zap.String(common.FieldID, id),
+		zap.Int("completedTasks", progress.CompletedTasks),
+		zap.Int("totalTasks", progress.TotalTasks))
+	return nil
+}
+
 // ListExpressions перечисляет все выражения, находящиеся в хранилище.
 func (s *Storage) ListExpressions() []*models.Expression {
 	var expressions []*models.Expression
@@ -129,12 +301,23 @@ func (s *Storage) ListExpressions() []*models.Expression {
 func isValidStatusTransition(from, to models.ExpressionStatus) bool {
 	switch from {
 	case models.StatusPending:
-		return to == models.StatusProgress || to == models.StatusError
+		return to == models.StatusProgress || to == models.StatusError ||
+			to == models.StatusCancelled || to == models.StatusTimeout
 	case models.StatusProgress:
-		return to == models.StatusComplete || to == models.StatusError
-	case models.StatusComplete, models.StatusError:
+		return to == models.StatusComplete || to == models.StatusError ||
+			to == models.StatusCancelled || to == models.StatusTimeout
+	case models.StatusError:
+		// Выражение возобновляется только повторной выдачей недоставленной задачи.
+		return to == models.StatusProgress
+	case models.StatusComplete, models.StatusCancelled, models.StatusTimeout:
 		return false
 	default:
 		return true
 	}
 }
+
+// isStopped сообщает, остановлено ли вычисление выражения пользователем или по истечении
+// времени: такое выражение больше не изменяется, а его задачи не выдаются агентам.
+func isStopped(status models.ExpressionStatus) bool {
+	return status == models.StatusCancelled || status == models.StatusTimeout
+}
@@ -0,0 +1,131 @@
+// Package storage предоставляет аренду задач, выданных агентам.
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/flexer2006/y.lms-sprint2-calculator/common"
+	"github.com/flexer2006/y.lms-sprint2-calculator/internal/server/models"
+
+	"github.com/google/uuid"
+)
+
+// defaultLeaseTimeout - время аренды задачи, если оно не задано WithLeaseTimeout.
+const defaultLeaseTimeout = 30 * time.Second
+
+// ErrLeaseNotHeld возвращается, когда результат или продление аренды присылает агент,
+// который не держит аренду задачи: она истекла, и задача вернулась в очередь.
+var ErrLeaseNotHeld = errors.New(common.ErrLeaseNotHeld)
+
+// lease - аренда выданной агенту задачи: пока она не истекла, задача не выдается
+// другим агентам.
+type lease struct {
+	token   string
+	expires time.Time
+}
+
+// WithLeaseTimeout задает время, в течение которого выданная задача невидима для
+// других агентов. Агент должен успеть прислать результат или продлить аренду,
+// иначе задача возвращается в очередь. timeout <= 0 оставляет значение по умолчанию.
+func WithLeaseTimeout(timeout time.Duration) Option {
+	return func(s *Storage) {
+		if timeout > 0 {
+			s.leaseTimeout = timeout
+		}
+	}
+}
+
+// grantLease выдает аренду задачи и записывает ее токен и время в задачу, отправляемую агенту.
+// Вызывающий должен держать s.mu.
+func (s *Storage) grantLease(task *models.Task) {
+	token := uuid.New().String()
+	s.leases[task.ID] = lease{token: token, expires: s.now().Add(s.leaseTimeout)}
+	task.LeaseToken = token
+	task.LeaseTimeoutMS = s.leaseTimeout.Milliseconds()
+}
+
+// expireLeases завершает попытки выполнить задачи, аренда которых истекла: задачи
+// возвращаются в очередь по правилам повтора. Вызывающий должен держать s.mu.
+func (s *Storage) expireLeases() {
+	now := s.now()
+	for id, l := range s.leases {
+		if !now.After(l.expires) {
+			continue
+		}
+		delete(s.leases, id)
+		if value, ok := s.tasks.Load(id); ok {
+			if task := value.(*models.Task); task.Result == nil {
+				s.fail(task, common.ErrLeaseExpired)
+			}
+		}
+	}
+}
+
+// ExtendLease продлевает аренду задачи агентом, который ее держит.
+func (s *Storage) ExtendLease(id, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expireLeases()
+	l, ok := s.leases[id]
+	if !ok || l.token != token {
+		return fmt.Errorf(common.ErrFormatWithWrap, id, ErrLeaseNotHeld)
+	}
+	l.expires = s.now().Add(s.leaseTimeout)
+	s.leases[id] = l
+	return nil
+}
+
+// CompleteTask принимает результат задачи от агента, который держит ее аренду.
+// Результат, пришедший после истечения аренды, принимается, пока задача
+// не вернулась в очередь.
+func (s *Storage) CompleteTask(id, token string, result float64) error {
+	if _, ok := s.tasks.Load(id); !ok {
+		return fmt.Errorf("task not found")
+	}
+
+	s.mu.Lock()
+	err := s.endLease(id, token)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	return s.UpdateTaskResult(id, result)
+}
+
+// FailTask принимает от агента, который держит аренду задачи, отказ ее вычислить.
+// Ошибка вычисления не исправится повтором, поэтому выражение сразу переходит
+// в статус ERROR с причиной отказа, а его невыполненные задачи отменяются.
+func (s *Storage) FailTask(id, token, reason string) error {
+	value, ok := s.tasks.Load(id)
+	if !ok {
+		return fmt.Errorf("task not found")
+	}
+	task := value.(*models.Task)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.endLease(id, token); err != nil {
+		return err
+	}
+	task.Error = reason
+	task.CompletedAt = s.now()
+	s.cancelExpression(task.ExpressionID)
+
+	return s.expressionError(task.ExpressionID, reason)
+}
+
+// endLease снимает аренду задачи, если ее держит агент с данным токеном.
+// Вызывающий должен держать s.mu.
+func (s *Storage) endLease(id, token string) error {
+	l, ok := s.leases[id]
+	if !ok || l.token != token {
+		return fmt.Errorf(common.ErrFormatWithWrap, id, ErrLeaseNotHeld)
+	}
+	delete(s.leases, id)
+	return nil
+}
@@ -0,0 +1,183 @@
+// Package storage предоставляет повторную выдачу задач и список недоставленных задач.
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/flexer2006/y.lms-sprint2-calculator/common"
+	"github.com/flexer2006/y.lms-sprint2-calculator/internal/server/models"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultMaxAttempts - число попыток выполнить задачу, если оно не задано WithRetryPolicy.
+	defaultMaxAttempts = 3
+	// maxRetryBackoff ограничивает экспоненциально растущую задержку повторной выдачи.
+	maxRetryBackoff = time.Minute
+)
+
+// retry - задача, ожидающая повторной выдачи после неудачной попытки.
+type retry struct {
+	taskID string
+	at     time.Time
+}
+
+// WithRetryPolicy задает число попыток выполнить задачу и задержку перед повторной
+// выдачей: после n-й неудачи задача возвращается в очередь через backoff·2^(n-1),
+// но не позже чем через минуту. Задача, исчерпавшая попытки, попадает в список
+// недоставленных, а ее выражение - в статус ERROR. maxAttempts <= 0 оставляет
+// значение по умолчанию.
+func WithRetryPolicy(maxAttempts int, backoff time.Duration) Option {
+	return func(s *Storage) {
+		if maxAttempts > 0 {
+			s.maxAttempts = maxAttempts
+		}
+		s.retryBackoff = backoff
+	}
+}
+
+// fail обрабатывает неудачную попытку выполнить задачу: планирует повторную выдачу
+// или, если попытки исчерпаны, переносит задачу в список недоставленных.
+// Вызывающий должен держать s.mu.
+func (s *Storage) fail(task *models.Task, reason string) {
+	if task.Attempts >= s.maxAttempts {
+		s.deadLetter(task, reason)
+		return
+	}
+
+	delay := s.backoff(task.Attempts)
+	s.retries = append(s.retries, retry{taskID: task.ID, at: s.now().Add(delay)})
+	s.logger.Warn("Task attempt failed, task will be retried",
+		zap.String("id", task.ID),
+		zap.String(common.FieldExpressionID, task.ExpressionID),
+		zap.Int("attempts", task.Attempts),
+		zap.Duration("backoff", delay),
+		zap.String("reason", reason))
+}
+
+// backoff возвращает задержку повторной выдачи после attempts неудачных попыток.
+func (s *Storage) backoff(attempts int) time.Duration {
+	delay := s.retryBackoff
+	for i := 1; i < attempts && delay < maxRetryBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryBackoff)
+}
+
+// requeueDue возвращает в начало очередей их выражений задачи, время повторной
+// выдачи которых наступило, более ранние задачи - первыми. Вызывающий должен
+// держать s.mu.
+func (s *Storage) requeueDue() {
+	now := s.now()
+	var due []models.Task
+	pending := s.retries[:0]
+	for _, r := range s.retries {
+		if now.Before(r.at) {
+			pending = append(pending, r)
+			continue
+		}
+		if value, ok := s.tasks.Load(r.taskID); ok {
+			due = append(due, *value.(*models.Task))
+		}
+	}
+	s.retries = pending
+	if len(due) == 0 {
+		return
+	}
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].CreatedAt.Before(due[j].CreatedAt)
+	})
+	for i := len(due) - 1; i >= 0; i-- {
+		s.taskQueue.pushFront(due[i], s.priority(due[i].ExpressionID))
+	}
+}
+
+// deadLetter переносит задачу в список недоставленных, отменяет остальные задачи
+// ее выражения и переводит выражение в статус ERROR. Вызывающий должен держать s.mu.
+func (s *Storage) deadLetter(task *models.Task, reason string) {
+	message := fmt.Sprintf(common.ErrTaskAttemptsExhausted, task.Operation, task.Attempts, reason)
+	s.cancelExpression(task.ExpressionID)
+	s.deadLetters[task.ID] = models.DeadLetter{Task: *task, Reason: message, FailedAt: s.now()}
+	s.logger.Error("Task moved to dead letters",
+		zap.String("id", task.ID),
+		zap.String(common.FieldExpressionID, task.ExpressionID),
+		zap.String("reason", message))
+
+	if err := s.expressionError(task.ExpressionID, message); err != nil {
+		s.logger.Error("Failed to update expression error status",
+			zap.String(common.FieldExpressionID, task.ExpressionID),
+			zap.Error(err))
+	}
+}
+
+// DeadLetters возвращает задачи, исчерпавшие попытки, в порядке их отказа.
+func (s *Storage) DeadLetters() []models.DeadLetter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	letters := make([]models.DeadLetter, 0, len(s.deadLetters))
+	for _, letter := range s.deadLetters {
+		letters = append(letters, letter)
+	}
+	sort.Slice(letters, func(i, j int) bool {
+		return letters[i].FailedAt.Before(letters[j].FailedAt)
+	})
+	return letters
+}
+
+// RequeueDeadLetter возвращает выражение недоставленной задачи из статуса ERROR
+// в IN_PROGRESS. Задача и остальные недоставленные задачи выражения получают новый
+// счетчик попыток, а все его невыполненные задачи, отмененные при отказе, снова
+// ставятся в очередь или ждут своих зависимостей.
+func (s *Storage) RequeueDeadLetter(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	letter, ok := s.deadLetters[id]
+	if !ok {
+		return fmt.Errorf("dead letter not found")
+	}
+	exprID := letter.Task.ExpressionID
+	value, ok := s.expressions.Load(exprID)
+	if !ok {
+		return fmt.Errorf("expression not found")
+	}
+	expr := value.(*models.Expression)
+	if !isValidStatusTransition(expr.Status, models.StatusProgress) {
+		return fmt.Errorf(common.ErrFormatWithWrap, exprID, ErrExpressionFinished)
+	}
+
+	var unfinished []*models.Task
+	s.tasks.Range(func(_, v interface{}) bool {
+		if task := v.(*models.Task); task.ExpressionID == exprID && task.Result == nil {
+			unfinished = append(unfinished, task)
+		}
+		return true
+	})
+	sort.Slice(unfinished, func(i, j int) bool {
+		return unfinished[i].CreatedAt.Before(unfinished[j].CreatedAt)
+	})
+	for _, task := range unfinished {
+		if _, ok := s.deadLetters[task.ID]; ok {
+			delete(s.deadLetters, task.ID)
+			task.Attempts = 0
+		}
+		s.schedule(task)
+	}
+
+	updated := *expr
+	updated.Status = models.StatusProgress
+	updated.Error = ""
+	updated.UpdatedAt = s.now()
+	s.expressions.Store(exprID, &updated)
+	s.rearmDeadline(exprID, expr.CreatedAt, expr.TimeoutMS)
+
+	s.logger.Info("Dead letter requeued",
+		zap.String("id", id),
+		zap.String(common.FieldExpressionID, exprID),
+		zap.Int("tasks", len(unfinished)))
+	return nil
+}
@@ -0,0 +1,142 @@
+// Package storage предоставляет очередь задач с приоритетами выражений.
+package storage
+
+import (
+	"sort"
+
+	"github.com/flexer2006/y.lms-sprint2-calculator/internal/server/models"
+)
+
+// scheduler - очередь готовых к выдаче задач. Задачи выражений с большим приоритетом
+// выдаются первыми, а выражения одного приоритета получают агентов по очереди,
+// по одной задаче, поэтому выражение из тысяч задач не задерживает остальные.
+// Задачи одного выражения выдаются по убыванию критического пути
+// (models.Task.CriticalPathMS), а при равном - в порядке поступления. Доступ
+// к scheduler защищен Storage.mu.
+type scheduler struct {
+	levels     map[int]*priorityLevel
+	priorities []int // Приоритеты непустых уровней по убыванию.
+	size       int
+}
+
+// priorityLevel - задачи выражений одного приоритета.
+type priorityLevel struct {
+	order  []string                 // Выражения в порядке очереди на выдачу задачи.
+	queues map[string][]models.Task // Задачи каждого выражения в порядке выдачи.
+}
+
+// newScheduler создает пустую очередь задач.
+func newScheduler() *scheduler {
+	return &scheduler{levels: make(map[int]*priorityLevel)}
+}
+
+// len возвращает число задач в очереди.
+func (q *scheduler) len() int {
+	return q.size
+}
+
+// push добавляет задачу в очередь ее выражения после задач с не меньшим
+// критическим путем. Выражение без задач в очереди встает в конец очереди выражений.
+func (q *scheduler) push(task models.Task, priority int) {
+	l := q.level(priority)
+	queue, ok := l.queues[task.ExpressionID]
+	if !ok {
+		l.order = append(l.order, task.ExpressionID)
+	}
+	i := len(queue)
+	for i > 0 && queue[i-1].CriticalPathMS < task.CriticalPathMS {
+		i--
+	}
+	queue = append(queue, models.Task{})
+	copy(queue[i+1:], queue[i:])
+	queue[i] = task
+	l.queues[task.ExpressionID] = queue
+	q.size++
+}
+
+// pushFront добавляет задачу в начало очереди ее выражения, чтобы она была
+// выдана раньше остальных его задач. Выражение без задач в очереди встает
+// в начало очереди выражений.
+func (q *scheduler) pushFront(task models.Task, priority int) {
+	l := q.level(priority)
+	queue, ok := l.queues[task.ExpressionID]
+	if !ok {
+		l.order = append([]string{task.ExpressionID}, l.order...)
+	}
+	l.queues[task.ExpressionID] = append([]models.Task{task}, queue...)
+	q.size++
+}
+
+// pop извлекает следующую задачу: первую задачу выражения, чья очередь подошла,
+// на уровне наибольшего приоритета. Выражение переходит в конец очереди уровня.
+func (q *scheduler) pop() (models.Task, bool) {
+	if q.size == 0 {
+		return models.Task{}, false
+	}
+	priority := q.priorities[0]
+	l := q.levels[priority]
+
+	exprID := l.order[0]
+	queue := l.queues[exprID]
+	task := queue[0]
+	l.order = l.order[1:]
+	if len(queue) > 1 {
+		l.queues[exprID] = queue[1:]
+		l.order = append(l.order, exprID)
+	} else {
+		delete(l.queues, exprID)
+	}
+	q.size--
+
+	if len(l.order) == 0 {
+		q.dropLevel(priority)
+	}
+	return task, true
+}
+
+// remove удаляет из очереди все задачи выражения.
+func (q *scheduler) remove(exprID string) {
+	for _, priority := range append([]int(nil), q.priorities...) {
+		l := q.levels[priority]
+		queue, ok := l.queues[exprID]
+		if !ok {
+			continue
+		}
+		q.size -= len(queue)
+		delete(l.queues, exprID)
+		for i, id := range l.order {
+			if id == exprID {
+				l.order = append(l.order[:i], l.order[i+1:]...)
+				break
+			}
+		}
+		if len(l.order) == 0 {
+			q.dropLevel(priority)
+		}
+	}
+}
+
+// level возвращает уровень приоритета, создавая его при необходимости.
+func (q *scheduler) level(priority int) *priorityLevel {
+	l, ok := q.levels[priority]
+	if !ok {
+		l = &priorityLevel{queues: make(map[string][]models.Task)}
+		q.levels[priority] = l
+		i := sort.Search(len(q.priorities), func(i int) bool { return q.priorities[i] < priority })
+		q.priorities = append(q.priorities, 0)
+		copy(q.priorities[i+1:], q.priorities[i:])
+		q.priorities[i] = priority
+	}
+	return l
+}
+
+// dropLevel удаляет опустевший уровень приоритета.
+func (q *scheduler) dropLevel(priority int) {
+	delete(q.levels, priority)
+	for i, p := range q.priorities {
+		if p == priority {
+			q.priorities = append(q.priorities[:i], q.priorities[i+1:]...)
+			break
+		}
+	}
+}
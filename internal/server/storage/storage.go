@@ -4,6 +4,7 @@ package storage
 import (
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/flexer2006/y.lms-sprint2-calculator/internal/server/models"
 
@@ -12,18 +13,54 @@ import (
 
 // Storage управляет хранением выражений и задач.
 type Storage struct {
-	expressions sync.Map
-	tasks       sync.Map
-	taskQueue   []models.Task // Slice to ensure FIFO order
-	mu          sync.Mutex
-	logger      *zap.Logger
+	expressions  sync.Map
+	tasks        sync.Map
+	taskQueue    *scheduler          // Задачи, готовые к выдаче агентам.
+	waiting      map[string]int      // Число невыполненных зависимостей задач, еще не попавших в очередь.
+	dependents   map[string][]string // Задачи, ожидающие результата задачи с данным идентификатором.
+	cache        *resultCache        // Кэш результатов задач; nil, если отключен.
+	leases       map[string]lease    // Аренды задач, выданных агентам.
+	leaseTimeout time.Duration
+	maxAttempts  int
+	retryBackoff time.Duration
+	retries      []retry                      // Задачи, ожидающие повторной выдачи.
+	deadLetters  map[string]models.DeadLetter // Задачи, исчерпавшие попытки.
+	deadlines    map[string]*time.Timer       // Таймеры ограничения времени незавершенных выражений.
+	now          func() time.Time             // Источник текущего времени.
+	mu           sync.Mutex
+	logger       *zap.Logger
 }
 
-// New создает новый экземпляр Storage с предоставленным logger.
-func New(logger *zap.Logger) *Storage {
-	return &Storage{
-		taskQueue: make([]models.Task, 0),
-		logger:    logger,
+// New создает новый экземпляр Storage с предоставленным logger и параметрами.
+func New(logger *zap.Logger, opts ...Option) *Storage {
+	s := &Storage{
+		taskQueue:    newScheduler(),
+		waiting:      make(map[string]int),
+		dependents:   make(map[string][]string),
+		leases:       make(map[string]lease),
+		leaseTimeout: defaultLeaseTimeout,
+		maxAttempts:  defaultMaxAttempts,
+		deadLetters:  make(map[string]models.DeadLetter),
+		deadlines:    make(map[string]*time.Timer),
+		now:          time.Now,
+		logger:       logger,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.cache != nil {
+		s.cache.now = s.now
+	}
+	return s
+}
+
+// WithClock задает источник текущего времени для аренд, повторов, кэша результатов
+// и отметок времени выражений и задач. По умолчанию используется time.Now.
+func WithClock(now func() time.Time) Option {
+	return func(s *Storage) {
+		if now != nil {
+			s.now = now
+		}
 	}
 }
 
@@ -32,7 +69,7 @@ func (s *Storage) GetTasksByDependency(taskID string) []*models.Task {
 	var dependentTasks []*models.Task
 	s.tasks.Range(func(_, value interface{}) bool {
 		task := value.(*models.Task)
-		for _, depID := range task.DependsOnTaskIDs {
+		for _, depID := range task.Dependencies() {
 			if depID == taskID {
 				dependentTasks = append(dependentTasks, task)
 				break
@@ -45,6 +82,14 @@ func (s *Storage) GetTasksByDependency(taskID string) []*models.Task {
 
 // GetTaskResult получает результат задачи по идентификатору.
 func (s *Storage) GetTaskResult(taskID string) (float64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.taskResult(taskID)
+}
+
+// taskResult получает результат задачи по идентификатору. Вызывающий должен держать s.mu.
+func (s *Storage) taskResult(taskID string) (float64, error) {
 	if value, ok := s.tasks.Load(taskID); ok {
 		task := value.(*models.Task)
 		if task.Result == nil {
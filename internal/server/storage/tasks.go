@@ -3,7 +3,6 @@ package storage
 
 import (
 	"fmt"
-	"time"
 
 	"github.com/flexer2006/y.lms-sprint2-calculator/common"
 	"github.com/flexer2006/y.lms-sprint2-calculator/internal/server/models"
@@ -11,7 +10,9 @@ import (
 	"go.uber.org/zap"
 )
 
-// SaveTask saves a task to storage and adds it to the task queue.
+// SaveTask saves a task to storage. A task whose dependencies already have results
+// is added to the task queue at once; otherwise it waits for the last of them.
+// Tasks of a cancelled or timed out expression are stored but never queued.
 func (s *Storage) SaveTask(task *models.Task) error {
 	if task.ID == "" {
 		s.logger.Error("Failed to save task: empty ID")
@@ -21,20 +22,160 @@ func (s *Storage) SaveTask(task *models.Task) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	now := time.Now()
+	now := s.now()
 	task.CreatedAt = now
 
 	taskCopy := *task
 	s.tasks.Store(task.ID, &taskCopy)
-	s.taskQueue = append(s.taskQueue, taskCopy)
+
+	if value, ok := s.expressions.Load(task.ExpressionID); ok && isStopped(value.(*models.Expression).Status) {
+		return nil
+	}
+
+	unresolved := s.schedule(&taskCopy)
 
 	s.logger.Info("Task saved successfully",
 		zap.String("id", task.ID),
 		zap.String(common.FieldExpressionID, task.ExpressionID),
-		zap.String(common.FieldOperation, task.Operation))
+		zap.String(common.FieldOperation, task.Operation),
+		zap.Int("unresolved", unresolved))
 	return nil
 }
 
+// schedule dispatches a task whose dependencies already have results or makes it
+// wait for the last of them, and returns the number of unresolved dependencies.
+// The caller must hold s.mu.
+func (s *Storage) schedule(task *models.Task) int {
+	unresolved := 0
+	for _, depID := range task.Dependencies() {
+		if _, err := s.taskResult(depID); err != nil {
+			s.dependents[depID] = append(s.dependents[depID], task.ID)
+			unresolved++
+		}
+	}
+	if unresolved == 0 {
+		s.dispatch(task)
+	} else {
+		s.waiting[task.ID] = unresolved
+	}
+	return unresolved
+}
+
+// dispatch appends a task with no unfinished dependencies to the queue or, if the
+// result cache already holds its result, completes it at once. The caller must
+// hold s.mu.
+func (s *Storage) dispatch(task *models.Task) {
+	if s.cache != nil {
+		if key, ok := s.cacheKey(task); ok {
+			if result, hit := s.cache.get(key); hit {
+				s.logger.Debug("Task result taken from cache",
+					zap.String("id", task.ID),
+					zap.String(common.FieldExpressionID, task.ExpressionID))
+				task.Result = &result
+				task.CompletedAt = s.now()
+				s.release(task.ID)
+				return
+			}
+		}
+	}
+	s.taskQueue.push(*task, s.priority(task.ExpressionID))
+}
+
+// priority returns the scheduling priority of an expression's tasks.
+func (s *Storage) priority(exprID string) int {
+	if value, ok := s.expressions.Load(exprID); ok {
+		return value.(*models.Expression).Priority
+	}
+	return 0
+}
+
+// cacheKey returns the result cache key of a task with its dependency results
+// substituted. The caller must hold s.mu.
+func (s *Storage) cacheKey(task *models.Task) (string, bool) {
+	resolved := *task
+	var err error
+	if resolved.Arg1, err = s.resolve(resolved.Arg1); err != nil {
+		return "", false
+	}
+	if resolved.Arg2, err = s.resolve(resolved.Arg2); err != nil {
+		return "", false
+	}
+	return taskKey(&resolved)
+}
+
+// cancelExpression drops every unfinished task of an expression from the queue,
+// the dependency graph, the leases, the retries and the dead letters, so that none
+// of them reaches an agent again. The caller must hold s.mu.
+func (s *Storage) cancelExpression(exprID string) {
+	belongs := func(taskID string) bool {
+		value, ok := s.tasks.Load(taskID)
+		return ok && value.(*models.Task).ExpressionID == exprID
+	}
+
+	s.taskQueue.remove(exprID)
+
+	for id := range s.waiting {
+		if belongs(id) {
+			delete(s.waiting, id)
+		}
+	}
+	for id := range s.dependents {
+		if belongs(id) {
+			delete(s.dependents, id)
+		}
+	}
+	for id := range s.leases {
+		if belongs(id) {
+			delete(s.leases, id)
+		}
+	}
+	retries := s.retries[:0]
+	for _, r := range s.retries {
+		if !belongs(r.taskID) {
+			retries = append(retries, r)
+		}
+	}
+	s.retries = retries
+	for id, letter := range s.deadLetters {
+		if letter.Task.ExpressionID == exprID {
+			delete(s.deadLetters, id)
+		}
+	}
+
+	s.logger.Info("Expression tasks canceled",
+		zap.String(common.FieldExpressionID, exprID))
+}
+
+// resolve substitutes the result of the referenced task into an operand.
+// The caller must hold s.mu.
+func (s *Storage) resolve(arg models.Operand) (models.Operand, error) {
+	if arg.TaskID == "" || arg.Value != nil {
+		return arg, nil
+	}
+	result, err := s.taskResult(arg.TaskID)
+	if err != nil {
+		return arg, err
+	}
+	arg.Value = &result
+	return arg, nil
+}
+
+// release decrements the number of unfinished dependencies of every task waiting
+// for the given one and enqueues those that have none left. The caller must hold s.mu.
+func (s *Storage) release(id string) {
+	for _, depID := range s.dependents[id] {
+		s.waiting[depID]--
+		if s.waiting[depID] > 0 {
+			continue
+		}
+		delete(s.waiting, depID)
+		if value, ok := s.tasks.Load(depID); ok {
+			s.dispatch(value.(*models.Task))
+		}
+	}
+	delete(s.dependents, id)
+}
+
 // GetTask retrieves a task by ID.
 func (s *Storage) GetTask(id string) (*models.Task, error) {
 	if value, ok := s.tasks.Load(id); ok {
@@ -47,15 +188,26 @@ func (s *Storage) GetTask(id string) (*models.Task, error) {
 	return nil, fmt.Errorf("task not found") // Исправлено на константную строку вместо strings.ToLower
 }
 
-// UpdateTaskResult updates a task's result and checks for expression completion.
+// UpdateTaskResult updates a task's result, stores it in the result cache,
+// enqueues the tasks that were waiting only for it and checks for expression
+// completion. A repeated result for the same task replaces the value but does
+// not release its dependents again.
 func (s *Storage) UpdateTaskResult(id string, result float64) error {
 	if value, ok := s.tasks.Load(id); ok {
 		task := value.(*models.Task)
+		s.mu.Lock()
+		delete(s.leases, id)
+		completed := task.Result != nil
 		task.Result = &result
-		s.tasks.Store(id, task)
-		s.logger.Info("Task result updated",
-			zap.String("id", id),
-			zap.Float64("result", result))
+		task.CompletedAt = s.now()
+		if !completed {
+			if s.cache != nil {
+				if key, ok := s.cacheKey(task); ok {
+					s.cache.put(key, result)
+				}
+			}
+			s.release(id)
+		}
 
 		allTasksCompleted := true
 		s.tasks.Range(func(_, v interface{}) bool {
@@ -66,6 +218,10 @@ func (s *Storage) UpdateTaskResult(id string, result float64) error {
 			}
 			return true
 		})
+		s.mu.Unlock()
+		s.logger.Info("Task result updated",
+			zap.String("id", id),
+			zap.Float64("result", result))
 
 		if allTasksCompleted {
 			if err := s.UpdateExpressionStatus(task.ExpressionID, models.StatusComplete); err != nil {
@@ -82,18 +238,40 @@ func (s *Storage) UpdateTaskResult(id string, result float64) error {
 	return fmt.Errorf("task not found") // Исправлено на константную строку вместо strings.ToLower
 }
 
-// GetNextTask retrieves and removes the next task from the queue.
+// GetNextTask retrieves and removes the next task from the queue, substituting
+// the results of its dependencies into the operands, counts the attempt and leases
+// the task to the caller. Expressions with a higher priority are served first, and
+// expressions of the same priority take turns. Tasks whose leases have expired are
+// retried or moved to the dead letters first, and retries that are due go to the
+// front of their expression's queue.
 func (s *Storage) GetNextTask() (*models.Task, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if len(s.taskQueue) == 0 {
+	s.expireLeases()
+	s.requeueDue()
+	task, ok := s.taskQueue.pop()
+	if !ok {
 		s.logger.Debug("No tasks available in queue")
 		return nil, fmt.Errorf("task not found")
 	}
+	if value, ok := s.tasks.Load(task.ID); ok {
+		stored := value.(*models.Task)
+		stored.Attempts++
+		task.Attempts = stored.Attempts
+	}
 
-	task := s.taskQueue[0]
-	s.taskQueue = s.taskQueue[1:]
+	var err error
+	if task.Arg1, err = s.resolve(task.Arg1); err == nil {
+		task.Arg2, err = s.resolve(task.Arg2)
+	}
+	if err != nil {
+		s.logger.Error("Failed to resolve task operands",
+			zap.String("id", task.ID),
+			zap.Error(err))
+		return nil, err
+	}
+	s.grantLease(&task)
 
 	s.logger.Info("Next task retrieved from queue",
 		zap.String("id", task.ID),
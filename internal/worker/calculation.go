@@ -1,32 +1,132 @@
 package worker
 
 import (
+	"errors"
+	"math"
+	"strconv"
+
 	"github.com/flexer2006/y.lms-sprint2-calculator/common"
 	"github.com/flexer2006/y.lms-sprint2-calculator/internal/server/models"
 
 	"go.uber.org/zap"
 )
 
-// Calculate выполняет вычисление.
-func (a *Agent) Calculate(task *models.Task) float64 {
-	switch task.Operation {
+// Calculate выполняет вычисление. Ошибка вычисления - деление на ноль, неизвестная
+// операция и т. п. - возвращается, чтобы агент сообщил о ней оркестратору.
+func (a *Agent) Calculate(task *models.Task) (float64, error) {
+	if len(task.Fragment) > 0 {
+		return a.calculateFragment(task)
+	}
+
+	arg1, ok1 := task.Arg1.Number()
+	arg2, ok2 := task.Arg2.Number()
+	if !ok1 || !ok2 {
+		a.logger.Error(common.ErrUnresolvedOperand,
+			zap.String(common.FieldTaskID, task.ID))
+		return 0, errors.New(common.ErrUnresolvedOperand)
+	}
+	return a.apply(task, task.Operation, arg1, arg2)
+}
+
+// calculateFragment вычисляет поддерево выражения, записанное во фрагменте задачи
+// в ОПН, подставляя значения аргументов задачи.
+func (a *Agent) calculateFragment(task *models.Task) (float64, error) {
+	var stack []float64
+	for _, token := range task.Fragment {
+		switch token {
+		case models.FragmentArg1, models.FragmentArg2:
+			arg := task.Arg1
+			if token == models.FragmentArg2 {
+				arg = task.Arg2
+			}
+			value, ok := arg.Number()
+			if !ok {
+				a.logger.Error(common.ErrUnresolvedOperand,
+					zap.String(common.FieldTaskID, task.ID))
+				return 0, errors.New(common.ErrUnresolvedOperand)
+			}
+			stack = append(stack, value)
+		case "+", "-", "*", "/", "^", "%":
+			if len(stack) < 2 {
+				return 0, a.invalidFragment(task)
+			}
+			result, err := a.apply(task, token, stack[len(stack)-2], stack[len(stack)-1])
+			if err != nil {
+				return 0, err
+			}
+			stack = append(stack[:len(stack)-2], result)
+		default:
+			value, err := strconv.ParseFloat(token, 64)
+			if err != nil {
+				return 0, a.invalidFragment(task)
+			}
+			stack = append(stack, value)
+		}
+	}
+	if len(stack) != 1 {
+		return 0, a.invalidFragment(task)
+	}
+	return stack[0], nil
+}
+
+// invalidFragment сообщает об ошибке в записи фрагмента задачи.
+func (a *Agent) invalidFragment(task *models.Task) error {
+	a.logger.Error(common.ErrInvalidFragment,
+		zap.String(common.FieldTaskID, task.ID),
+		zap.Strings("fragment", task.Fragment))
+	return errors.New(common.ErrInvalidFragment)
+}
+
+// apply выполняет операцию задачи над двумя числами. NaN и бесконечность не
+// кодируются в JSON, поэтому такой результат считается ошибкой задачи.
+func (a *Agent) apply(task *models.Task, op string, arg1, arg2 float64) (float64, error) {
+	result, err := a.operate(task, op, arg1, arg2)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(result) || math.IsInf(result, 0) {
+		a.logger.Error(common.ErrNonFiniteResult,
+			zap.String(common.FieldTaskID, task.ID),
+			zap.String(common.FieldOperation, op))
+		return 0, errors.New(common.ErrNonFiniteResult)
+	}
+	return result, nil
+}
+
+// operate вычисляет операцию над двумя числами.
+func (a *Agent) operate(task *models.Task, op string, arg1, arg2 float64) (float64, error) {
+	switch op {
 	case "+":
-		return task.Arg1 + task.Arg2
+		return arg1 + arg2, nil
 	case "-":
-		return task.Arg1 - task.Arg2
+		return arg1 - arg2, nil
 	case "*":
-		return task.Arg1 * task.Arg2
+		return arg1 * arg2, nil
 	case "/":
-		if task.Arg2 == 0 {
+		if arg2 == 0 {
 			a.logger.Error(common.ErrDivisionByZero,
 				zap.String(common.FieldTaskID, task.ID))
-			panic(common.ErrDivisionByZero)
+			return 0, errors.New(common.ErrDivisionByZero)
+		}
+		return arg1 / arg2, nil
+	case "^":
+		return math.Pow(arg1, arg2), nil
+	case "%":
+		if arg2 == 0 {
+			a.logger.Error(common.ErrModuloByZero,
+				zap.String(common.FieldTaskID, task.ID))
+			return 0, errors.New(common.ErrModuloByZero)
+		}
+		if arg1 != math.Trunc(arg1) || arg2 != math.Trunc(arg2) {
+			a.logger.Error(common.ErrInvalidModulo,
+				zap.String(common.FieldTaskID, task.ID))
+			return 0, errors.New(common.ErrInvalidModulo)
 		}
-		return task.Arg1 / task.Arg2
+		return math.Mod(arg1, arg2), nil
 	default:
 		a.logger.Error(common.ErrUnexpectedToken,
 			zap.String(common.FieldTaskID, task.ID),
-			zap.String(common.FieldOperation, task.Operation))
-		panic(common.ErrUnexpectedToken)
+			zap.String(common.FieldOperation, op))
+		return 0, errors.New(common.ErrUnexpectedToken)
 	}
 }
@@ -40,23 +40,42 @@ func (a *Agent) getTask() (*models.Task, error) {
 	return &taskResp.Task, nil
 }
 
-// sendResult отправляет результат вычисления в оркестратор.
-func (a *Agent) sendResult(taskID string, result float64) error {
+// sendResult отправляет результат вычисления в оркестратор вместе с токеном аренды задачи.
+func (a *Agent) sendResult(task *models.Task, result float64) error {
 	taskResult := models.TaskResult{
-		ID:     taskID,
-		Result: result,
+		ID:         task.ID,
+		Result:     result,
+		LeaseToken: task.LeaseToken,
 	}
 
-	body, err := json.Marshal(taskResult)
+	return a.post(fmt.Sprintf(common.PathInternalTask, a.config.OrchestratorURL), taskResult)
+}
+
+// sendFailure сообщает оркестратору, что задачу нельзя вычислить, и почему.
+func (a *Agent) sendFailure(task *models.Task, calcErr error) error {
+	taskResult := models.TaskResult{
+		ID:         task.ID,
+		Error:      calcErr.Error(),
+		LeaseToken: task.LeaseToken,
+	}
+
+	return a.post(fmt.Sprintf(common.PathInternalTask, a.config.OrchestratorURL), taskResult)
+}
+
+// extendLease продлевает аренду задачи в оркестраторе.
+func (a *Agent) extendLease(task *models.Task) error {
+	return a.post(fmt.Sprintf(common.PathInternalTaskLease, a.config.OrchestratorURL, task.ID),
+		models.LeaseRequest{LeaseToken: task.LeaseToken})
+}
+
+// post отправляет payload в оркестратор и ожидает ответ 200 OK.
+func (a *Agent) post(url string, payload interface{}) error {
+	body, err := json.Marshal(payload)
 	if err != nil {
 		return err
 	}
 
-	resp, err := a.httpClient.Post(
-		fmt.Sprintf(common.PathInternalTask, a.config.OrchestratorURL),
-		common.ContentTypeJSON,
-		bytes.NewBuffer(body),
-	)
+	resp, err := a.httpClient.Post(url, common.ContentTypeJSON, bytes.NewBuffer(body))
 	if err != nil {
 		return err
 	}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/flexer2006/y.lms-sprint2-calculator/common"
+	"github.com/flexer2006/y.lms-sprint2-calculator/internal/server/models"
 	"go.uber.org/zap"
 )
 
@@ -44,26 +45,91 @@ func (a *Agent) processTask(workerID int) error {
 		zap.String(common.FieldTaskID, task.ID),
 		zap.String(common.FieldOperation, task.Operation))
 
-	var operationTime time.Duration = 100 * time.Millisecond
+	stop := a.keepLease(task)
+	defer stop()
 
-	switch task.Operation {
-	case "+":
-		operationTime = 1000 * time.Millisecond
-	case "-":
-		operationTime = 1000 * time.Millisecond
-	case "*":
-		operationTime = 1000 * time.Millisecond
-	case "/":
-		operationTime = 1000 * time.Millisecond
-	}
-
-	time.Sleep(operationTime)
+	time.Sleep(a.operationTime(task))
 
-	result := a.Calculate(task)
+	result, calcErr := a.Calculate(task)
+	if calcErr != nil {
+		if err := a.sendFailure(task, calcErr); err != nil {
+			return fmt.Errorf(common.ErrFormatWithWrap, common.LogFailedSendFailure, err)
+		}
+		return nil
+	}
 
-	if err := a.sendResult(task.ID, result); err != nil {
+	if err := a.sendResult(task, result); err != nil {
 		return fmt.Errorf(common.ErrFormatWithWrap, common.LogFailedSendResult, err)
 	}
 
 	return nil
 }
+
+// keepLease продлевает аренду задачи каждые полпериода аренды, пока задача вычисляется.
+// Возвращает функцию, останавливающую продление.
+func (a *Agent) keepLease(task *models.Task) func() {
+	if task.LeaseToken == "" || task.LeaseTimeoutMS <= 0 {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(time.Duration(task.LeaseTimeoutMS) * time.Millisecond / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := a.extendLease(task); err != nil {
+					a.logger.Warn("Failed to extend task lease",
+						zap.String(common.FieldTaskID, task.ID),
+						zap.Error(err))
+					return
+				}
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// operationTime возвращает время выполнения задачи, заданное оркестратором,
+// а если оно не задано - время операции из конфигурации агента. Время задачи
+// с фрагментом - сумма времен всех его операций.
+func (a *Agent) operationTime(task *models.Task) time.Duration {
+	if task.OperationTime > 0 {
+		return time.Duration(task.OperationTime) * time.Millisecond
+	}
+	if len(task.Fragment) == 0 {
+		return a.configuredTime(task.Operation)
+	}
+
+	var total time.Duration
+	for _, token := range task.Fragment {
+		switch token {
+		case "+", "-", "*", "/", "^", "%":
+			total += a.configuredTime(token)
+		}
+	}
+	return total
+}
+
+// configuredTime возвращает время операции из конфигурации агента.
+func (a *Agent) configuredTime(op string) time.Duration {
+	ms := int64(100)
+	switch op {
+	case "+":
+		ms = a.config.AdditionTimeMS
+	case "-":
+		ms = a.config.SubtractionTimeMS
+	case "*":
+		ms = a.config.MultiplyTimeMS
+	case "/":
+		ms = a.config.DivisionTimeMS
+	case "^":
+		ms = a.config.PowerTimeMS
+	case "%":
+		ms = a.config.ModuloTimeMS
+	}
+	return time.Duration(ms) * time.Millisecond
+}
@@ -2,8 +2,11 @@
 package calculation
 
 import (
+	"context"
 	"errors"
 
+	"github.com/flexer2006/y.lms-sprint2-calculator/common"
+
 	"go.uber.org/zap"
 )
 
@@ -12,26 +15,124 @@ var logger *zap.Logger
 // EvaluateExpression evaluates a mathematical expression and returns the result.
 // It returns an error if the expression is empty or invalid.
 func EvaluateExpression(expression string) (float64, error) {
-	if expression == "" {
-		return 0, errors.New("expression is empty")
+	return EvaluateContext(context.Background(), expression, Limits{})
+}
+
+// EvaluateContext evaluates a mathematical expression like EvaluateExpression,
+// aborting with a *LimitError when one of limits is exceeded and with a
+// *CanceledError when ctx is done before evaluation completes.
+func EvaluateContext(ctx context.Context, expression string, limits Limits) (float64, error) {
+	value, err := EvaluateValue(ctx, expression, limits)
+	if err != nil {
+		return 0, err
+	}
+	if value.Kind != ScalarValue {
+		return 0, errors.New(common.ErrNotScalar)
 	}
+	return value.Scalar, nil
+}
 
-	tokens := tokenize(expression)
-	if len(tokens) == 0 {
-		return 0, errors.New("invalid expression")
+// EvaluateValue evaluates an expression that may produce a list or a matrix,
+// such as [1, 2, 3] * 2 or [[1, 2], [3, 4]] * [5, 6], under the same limits
+// as EvaluateContext.
+func EvaluateValue(ctx context.Context, expression string, limits Limits) (Value, error) {
+	root, err := parseExpression(ctx, expression, limits)
+	if err != nil {
+		return Value{}, err
 	}
 
-	if logger != nil {
-		logger.Debug("Tokens generated", zap.Strings("tokens", tokens))
+	e := &evaluator{ctx: ctx, limits: limits}
+	result, err := e.eval(root)
+	if err != nil {
+		if logger != nil {
+			logger.Error("Evaluation failed", zap.Error(err), zap.String("expression", expression))
+		}
+		return Value{}, err
+	}
+	return result, nil
+}
+
+// SplitMatrixProduct evaluates an expression whose outermost operation is a
+// matrix product, such as [[1, 2], [3, 4]] * [[5, 6], [7, 8]], and returns
+// both operands as matrices so that the product can be computed cell by cell.
+// A list operand is a row vector on the left and a column vector on the right.
+// ok is false when the expression is valid but is not a matrix product.
+func SplitMatrixProduct(ctx context.Context, expression string, limits Limits) (left, right [][]float64, ok bool, err error) {
+	root, err := parseExpression(ctx, expression, limits)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	e := &evaluator{ctx: ctx, limits: limits}
+	if root.kind != binaryNode || root.token.Text != "*" {
+		_, err := e.eval(root)
+		return nil, nil, false, err
 	}
 
-	parser := &Parser{tokens: tokens, pos: 0}
-	result, err := parser.parse()
+	a, err := e.eval(root.args[0])
+	if err != nil {
+		return nil, nil, false, err
+	}
+	b, err := e.eval(root.args[1])
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if _, err := e.reduce(root, []Value{a, b}); err != nil {
+		return nil, nil, false, err
+	}
+	if a.Kind == ScalarValue || b.Kind == ScalarValue || a.Kind != MatrixValue && b.Kind != MatrixValue {
+		return nil, nil, false, nil
+	}
+
+	left, right = productOperands(a, b)
+	return left, right, true, nil
+}
+
+// parseExpression tokenizes and parses expression into a tree.
+func parseExpression(ctx context.Context, expression string, limits Limits) (*node, error) {
+	parser, err := newParser(ctx, expression, limits)
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := parser.parse()
 	if err != nil {
 		if logger != nil {
 			logger.Error("Parser failed", zap.Error(err), zap.String("expression", expression))
 		}
-		return 0, err
+		return nil, err
 	}
-	return result, nil
+	return root, nil
+}
+
+// newParser tokenizes expression and returns a parser for it.
+func newParser(ctx context.Context, expression string, limits Limits) (*Parser, error) {
+	if expression == "" {
+		return nil, errors.New("expression is empty")
+	}
+
+	if err := limits.checkInput(expression); err != nil {
+		return nil, err
+	}
+
+	tokens, err := tokenize(expression)
+	if err != nil {
+		if logger != nil {
+			logger.Error("Tokenizer failed", zap.Error(err), zap.String("expression", expression))
+		}
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, errors.New("invalid expression")
+	}
+
+	if err := limits.checkTokens(len(tokens)); err != nil {
+		return nil, err
+	}
+
+	parser := &Parser{tokens: tokens, pos: 0, ctx: ctx, limits: limits}
+	if logger != nil {
+		logger.Debug("Tokens generated", zap.Strings("tokens", parser.texts()))
+	}
+	return parser, nil
 }
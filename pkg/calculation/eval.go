@@ -0,0 +1,196 @@
+// Package calculation provides evaluation of parsed expressions.
+package calculation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/flexer2006/y.lms-sprint2-calculator/common"
+)
+
+// ErrBoundsNotFinite is returned for a range, sum, product or integral whose
+// bound is NaN or infinite.
+var ErrBoundsNotFinite = errors.New(common.ErrBoundsNotFinite)
+
+// evaluator computes the value of an expression tree.
+type evaluator struct {
+	ctx    context.Context    // Context checked for cancellation while evaluating.
+	limits Limits             // Resource limits enforced while evaluating.
+	vars   map[string]float64 // Current values of the bound variables.
+}
+
+// eval evaluates the tree rooted at n, operands left to right. The body of a
+// construct with a bound variable is evaluated by the construct itself.
+func (e *evaluator) eval(n *node) (Value, error) {
+	if n.kind == valueNode {
+		return n.value, nil
+	}
+	if err := e.ctx.Err(); err != nil {
+		return Value{}, &CanceledError{Err: err}
+	}
+
+	operands := n.args
+	if n.kind == boundNode {
+		operands = operands[:2]
+	}
+	args := make([]Value, len(n.args))
+	for i, arg := range operands {
+		value, err := e.eval(arg)
+		if err != nil {
+			return Value{}, err
+		}
+		args[i] = value
+	}
+	return e.reduce(n, args)
+}
+
+// reduce computes the value of n from the values of its operands.
+func (e *evaluator) reduce(n *node, args []Value) (Value, error) {
+	var (
+		result Value
+		err    error
+	)
+
+	switch n.kind {
+	case valueNode:
+		return n.value, nil
+	case unaryNode:
+		return mapValue(args[0], func(x float64) (float64, error) { return -x, nil })
+	case absNode:
+		return mapValue(args[0], func(x float64) (float64, error) { return math.Abs(x), nil })
+	case postfixNode:
+		result, err = postfix(n.token, args[0])
+	case binaryNode:
+		result, err = operate(n.token, args[0], args[1])
+	case rangeNode:
+		return e.expandRange(n.token, args[0], args[1])
+	case listNode:
+		return e.buildList(n, args)
+	case callNode:
+		result, err = callFunction(n.token, args)
+	case variableNode:
+		return Scalar(e.vars[n.token.Text]), nil
+	case boundNode:
+		result, err = e.bound(n, args[0], args[1])
+	}
+	if err != nil {
+		return Value{}, err
+	}
+	return result, e.checkValue(result)
+}
+
+// postfix applies a postfix operator: factorial, ² or ³.
+func postfix(op Token, v Value) (Value, error) {
+	if v.Kind == MatrixValue && op.Text != "!" {
+		return Value{}, matrixOperatorError(op)
+	}
+
+	switch op.Text {
+	case "²":
+		return mapValue(v, func(x float64) (float64, error) { return x * x, nil })
+	case "³":
+		return mapValue(v, func(x float64) (float64, error) { return x * x * x, nil })
+	default:
+		return mapValue(v, factorial)
+	}
+}
+
+// expandRange returns the list from start to end inclusive, counting up or down by one.
+func (e *evaluator) expandRange(op Token, start, end Value) (Value, error) {
+	if start.Kind != ScalarValue || end.Kind != ScalarValue {
+		return Value{}, fmt.Errorf("%s at position %d", common.ErrRangeBoundsNotScalar, op.Pos)
+	}
+
+	from, to := start.Scalar, end.Scalar
+	if !isFinite(from) || !isFinite(to) {
+		return Value{}, fmt.Errorf("%w at position %d", ErrBoundsNotFinite, op.Pos)
+	}
+	step := 1.0
+	if to < from {
+		step = -1
+	}
+	count := math.Floor(math.Abs(to-from)) + 1
+	if err := e.limits.checkListElements(count); err != nil {
+		return Value{}, err
+	}
+
+	elements := make([]float64, 0, int(count))
+	for i := 0.0; i < count; i++ {
+		elements = append(elements, from+i*step)
+	}
+	return List(elements), nil
+}
+
+// buildList assembles a list literal from its element values. Ranges among
+// the elements are spliced in, so [0, 1..3] is [0, 1, 2, 3]. A list whose
+// elements are all lists is a matrix, one row per element.
+func (e *evaluator) buildList(n *node, args []Value) (Value, error) {
+	var (
+		elements = []float64{}
+		rows     [][]float64
+		count    int
+	)
+
+	for i, element := range args {
+		isRange := n.args[i].isRange()
+		switch {
+		case element.Kind == MatrixValue:
+			return Value{}, fmt.Errorf("%s at position %d", common.ErrNestedList, n.token.Pos)
+		case rows == nil && element.Kind == ScalarValue:
+			elements = append(elements, element.Scalar)
+		case rows == nil && isRange:
+			elements = append(elements, element.List...)
+		case len(elements) == 0 && element.Kind == ListValue && !isRange:
+			rows = append(rows, element.List)
+		default:
+			return Value{}, fmt.Errorf("%s at position %d", common.ErrMatrixRows, n.token.Pos)
+		}
+		count += len(element.elements())
+		if err := e.limits.checkListElements(float64(count)); err != nil {
+			return Value{}, err
+		}
+	}
+
+	if rows == nil {
+		return List(elements), nil
+	}
+	for _, row := range rows {
+		if len(row) == 0 || len(row) != len(rows[0]) {
+			return Value{}, fmt.Errorf("%s at position %d", common.ErrMatrixRows, n.token.Pos)
+		}
+	}
+	return Matrix(rows), nil
+}
+
+// checkValue checks every element of a value against the magnitude limit.
+func (e *evaluator) checkValue(v Value) error {
+	for _, x := range v.elements() {
+		if err := e.limits.checkMagnitude(x); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// factorial returns x!. Non-integer arguments use the gamma function, x! = Γ(x+1).
+func factorial(x float64) (float64, error) {
+	if x < 0 && x == math.Trunc(x) {
+		return 0, errors.New(common.ErrFactorialNegative)
+	}
+	if x != math.Trunc(x) {
+		return math.Gamma(x + 1), nil
+	}
+
+	result := 1.0
+	for i := 2.0; i <= x && !math.IsInf(result, 1); i++ {
+		result *= i
+	}
+	return result, nil
+}
+
+// isFinite reports whether x is neither NaN nor infinite.
+func isFinite(x float64) bool {
+	return !math.IsNaN(x) && !math.IsInf(x, 0)
+}
@@ -0,0 +1,207 @@
+// Package calculation provides formatting of calculation results.
+package calculation
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/flexer2006/y.lms-sprint2-calculator/common"
+)
+
+// RoundingMode selects how a result is rounded to the requested number of digits.
+type RoundingMode string
+
+const (
+	// RoundHalfEven rounds to the nearest value, ties to the even digit.
+	RoundHalfEven RoundingMode = "half-even"
+	// RoundHalfUp rounds to the nearest value, ties away from zero.
+	RoundHalfUp RoundingMode = "half-up"
+	// RoundDown truncates towards zero.
+	RoundDown RoundingMode = "down"
+)
+
+// Notation selects how a formatted result is written.
+type Notation string
+
+const (
+	// NotationPlain writes the number without an exponent, e.g. 1234.50.
+	NotationPlain Notation = "plain"
+	// NotationScientific writes one integer digit and an exponent, e.g. 1.23e+3.
+	NotationScientific Notation = "scientific"
+	// NotationEngineering writes an exponent that is a multiple of three, e.g. 12.3e+3.
+	NotationEngineering Notation = "engineering"
+)
+
+// MaxFormatDigits is the largest number of fractional digits Format accepts.
+const MaxFormatDigits = 20
+
+// FormatOptions controls how Format renders a number.
+// Empty Rounding and Notation default to RoundHalfEven and NotationPlain.
+type FormatOptions struct {
+	Digits   int          // Digits after the decimal point (of the mantissa, with an exponent).
+	Rounding RoundingMode // Rounding rule applied to the dropped digits.
+	Notation Notation     // Output notation.
+}
+
+// Validate checks that the options are supported.
+func (o FormatOptions) Validate() error {
+	if o.Digits < 0 || o.Digits > MaxFormatDigits {
+		return fmt.Errorf("%s: %d (allowed 0..%d)", common.ErrInvalidFormatDigits, o.Digits, MaxFormatDigits)
+	}
+	switch o.Rounding {
+	case "", RoundHalfEven, RoundHalfUp, RoundDown:
+	default:
+		return fmt.Errorf("%s: %q", common.ErrInvalidRoundingMode, o.Rounding)
+	}
+	switch o.Notation {
+	case "", NotationPlain, NotationScientific, NotationEngineering:
+	default:
+		return fmt.Errorf("%s: %q", common.ErrInvalidNotation, o.Notation)
+	}
+	return nil
+}
+
+// Format renders value according to opts. Rounding is applied to the shortest
+// decimal representation of value, so 2.675 rounds half-up to 2.68 even though
+// the nearest float64 is slightly below it. NaN and infinities are returned as is.
+func Format(value float64, opts FormatOptions) (string, error) {
+	if err := opts.Validate(); err != nil {
+		return "", err
+	}
+	if opts.Rounding == "" {
+		opts.Rounding = RoundHalfEven
+	}
+
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return strconv.FormatFloat(value, 'g', -1, 64), nil
+	}
+
+	digits, exponent := decompose(math.Abs(value))
+
+	var text string
+	switch opts.Notation {
+	case NotationScientific:
+		text = formatExponent(digits, exponent, opts, 1)
+	case NotationEngineering:
+		text = formatExponent(digits, exponent, opts, 3)
+	default:
+		text = formatPlain(digits, exponent, opts)
+	}
+
+	if value < 0 && strings.ContainsAny(text[:mantissaEnd(text)], "123456789") {
+		text = "-" + text
+	}
+	return text, nil
+}
+
+// decompose splits a non-negative value into its shortest significant digits and
+// decimal exponent, so that value = d.ddd × 10^exponent.
+func decompose(value float64) (string, int) {
+	if value == 0 {
+		return "0", 0
+	}
+
+	text := strconv.FormatFloat(value, 'e', -1, 64)
+	mantissa, exp, _ := strings.Cut(text, "e")
+	exponent, _ := strconv.Atoi(exp)
+	return strings.Replace(mantissa, ".", "", 1), exponent
+}
+
+// formatPlain renders digits × 10^exponent with a fixed number of fractional digits.
+func formatPlain(digits string, exponent int, opts FormatOptions) string {
+	kept, _ := roundDigits(digits, exponent+1+opts.Digits, opts.Rounding)
+	if len(kept) < opts.Digits+1 {
+		kept = strings.Repeat("0", opts.Digits+1-len(kept)) + kept
+	}
+
+	integer := kept[:len(kept)-opts.Digits]
+	if opts.Digits == 0 {
+		return integer
+	}
+	return integer + "." + kept[len(kept)-opts.Digits:]
+}
+
+// formatExponent renders digits × 10^exponent with an exponent that is a multiple of step.
+func formatExponent(digits string, exponent int, opts FormatOptions, step int) string {
+	base := floorDiv(exponent, step) * step
+	integerDigits := exponent - base + 1
+
+	kept, carry := roundDigits(digits, integerDigits+opts.Digits, opts.Rounding)
+	if carry {
+		// Rounding produced an exact power of ten that may belong to the next exponent group.
+		return formatExponent("1", exponent+1, opts, step)
+	}
+
+	text := kept[:integerDigits]
+	if opts.Digits > 0 {
+		text += "." + kept[integerDigits:]
+	}
+
+	sign := "+"
+	if base < 0 {
+		sign = "-"
+		base = -base
+	}
+	return text + "e" + sign + strconv.Itoa(base)
+}
+
+// roundDigits keeps the first keep digits of digits, rounding the rest away
+// according to mode. It reports carry when rounding overflowed into a new
+// leading digit, in which case the result is one digit longer than keep.
+func roundDigits(digits string, keep int, mode RoundingMode) (string, bool) {
+	if keep >= len(digits) {
+		return digits + strings.Repeat("0", keep-len(digits)), false
+	}
+	if keep < 0 {
+		return "", false
+	}
+
+	kept := digits[:keep]
+	first := digits[keep]
+	rest := strings.Trim(digits[keep+1:], "0") != ""
+
+	var up bool
+	switch mode {
+	case RoundHalfUp:
+		up = first >= '5'
+	case RoundHalfEven:
+		switch {
+		case first > '5', first == '5' && rest:
+			up = true
+		case first == '5':
+			up = keep > 0 && (kept[keep-1]-'0')%2 == 1
+		}
+	}
+	if !up {
+		return kept, false
+	}
+
+	buf := []byte(kept)
+	for i := len(buf) - 1; i >= 0; i-- {
+		if buf[i] != '9' {
+			buf[i]++
+			return string(buf), false
+		}
+		buf[i] = '0'
+	}
+	return "1" + string(buf), true
+}
+
+// mantissaEnd returns the length of text without its exponent suffix.
+func mantissaEnd(text string) int {
+	if i := strings.IndexByte(text, 'e'); i >= 0 {
+		return i
+	}
+	return len(text)
+}
+
+// floorDiv divides a by b rounding towards negative infinity.
+func floorDiv(a, b int) int {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
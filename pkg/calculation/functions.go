@@ -0,0 +1,260 @@
+// Package calculation provides the built-in functions available in expressions.
+package calculation
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/flexer2006/y.lms-sprint2-calculator/common"
+)
+
+// aggregate reduces a list of numbers to a single number.
+type aggregate func(values []float64) (float64, error)
+
+// aggregates maps function names to aggregate implementations.
+// Every argument of an aggregate call is flattened into one list,
+// so sum([1, 2], 3) and sum(1, 2, 3) are equivalent.
+var aggregates = map[string]aggregate{
+	"sum":    aggregateSum,
+	"avg":    aggregateAvg,
+	"median": aggregateMedian,
+	"stdev":  aggregateStdev,
+	"min":    aggregateMin,
+	"max":    aggregateMax,
+	"count":  aggregateCount,
+	"prod":   aggregateProd,
+}
+
+// boundConstructs are the functions that take a bound variable, as in
+// sum(i, 1, 100, i^2): the body is evaluated for values of the variable
+// between the bounds. sum and prod are also aggregates when called without
+// a variable.
+var boundConstructs = map[string]bool{
+	"sum":       true,
+	"prod":      true,
+	"integrate": true,
+}
+
+// matrixFunction is a function of a fixed number of matrix arguments.
+type matrixFunction struct {
+	arity int
+	call  func(args []Value) (Value, error)
+}
+
+// matrixFunctions maps function names to matrix functions.
+// Scalars are treated as 1×1 matrices and lists as rows.
+var matrixFunctions = map[string]matrixFunction{
+	"transpose": {arity: 1, call: matrixTranspose},
+	"det":       {arity: 1, call: matrixDet},
+	"inv":       {arity: 1, call: matrixInv},
+	"solve":     {arity: 2, call: matrixSolve},
+}
+
+// isFunction reports whether name is a known function.
+func isFunction(name string) bool {
+	_, isAggregate := aggregates[name]
+	_, isMatrix := matrixFunctions[name]
+	return isAggregate || isMatrix || boundConstructs[name]
+}
+
+// callFunction applies the named function to args.
+// Dimension errors point at the function name.
+func callFunction(name Token, args []Value) (Value, error) {
+	if fn, ok := matrixFunctions[name.Text]; ok {
+		if len(args) != fn.arity {
+			return Value{}, fmt.Errorf("%s for %q at position %d: want %d, got %d",
+				common.ErrFunctionArity, name.Text, name.Pos, fn.arity, len(args))
+		}
+
+		result, err := fn.call(args)
+		var dimErr *DimensionError
+		if errors.As(err, &dimErr) {
+			dimErr.Op, dimErr.Pos = name.Text, name.Pos
+			return Value{}, err
+		}
+		if err != nil {
+			return Value{}, fmt.Errorf("%s: %w", name.Text, err)
+		}
+		return result, nil
+	}
+
+	fn, ok := aggregates[name.Text]
+	if !ok {
+		return Value{}, fmt.Errorf("%s %q", common.ErrUnknownFunction, name.Text)
+	}
+
+	var values []float64
+	for _, arg := range args {
+		values = append(values, arg.elements()...)
+	}
+
+	result, err := fn(values)
+	if err != nil {
+		return Value{}, fmt.Errorf("%s: %w", name.Text, err)
+	}
+	return Scalar(result), nil
+}
+
+// aggregateSum returns the sum of values; the sum of no values is 0.
+func aggregateSum(values []float64) (float64, error) {
+	var sum float64
+	for _, x := range values {
+		sum += x
+	}
+	return sum, nil
+}
+
+// aggregateAvg returns the arithmetic mean of values.
+func aggregateAvg(values []float64) (float64, error) {
+	if len(values) == 0 {
+		return 0, errors.New(common.ErrEmptyAggregate)
+	}
+	sum, _ := aggregateSum(values)
+	return sum / float64(len(values)), nil
+}
+
+// aggregateMedian returns the median of values.
+func aggregateMedian(values []float64) (float64, error) {
+	if len(values) == 0 {
+		return 0, errors.New(common.ErrEmptyAggregate)
+	}
+
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 1 {
+		return sorted[mid], nil
+	}
+	return (sorted[mid-1] + sorted[mid]) / 2, nil
+}
+
+// aggregateStdev returns the sample standard deviation of values.
+func aggregateStdev(values []float64) (float64, error) {
+	if len(values) < 2 {
+		return 0, errors.New(common.ErrStdevTooFewValues)
+	}
+
+	mean, _ := aggregateAvg(values)
+	var squares float64
+	for _, x := range values {
+		squares += (x - mean) * (x - mean)
+	}
+	return math.Sqrt(squares / float64(len(values)-1)), nil
+}
+
+// aggregateMin returns the smallest of values.
+func aggregateMin(values []float64) (float64, error) {
+	if len(values) == 0 {
+		return 0, errors.New(common.ErrEmptyAggregate)
+	}
+	result := values[0]
+	for _, x := range values[1:] {
+		result = math.Min(result, x)
+	}
+	return result, nil
+}
+
+// aggregateMax returns the largest of values.
+func aggregateMax(values []float64) (float64, error) {
+	if len(values) == 0 {
+		return 0, errors.New(common.ErrEmptyAggregate)
+	}
+	result := values[0]
+	for _, x := range values[1:] {
+		result = math.Max(result, x)
+	}
+	return result, nil
+}
+
+// aggregateProd returns the product of values; the product of no values is 1.
+func aggregateProd(values []float64) (float64, error) {
+	product := 1.0
+	for _, x := range values {
+		product *= x
+	}
+	return product, nil
+}
+
+// aggregateCount returns the number of values.
+func aggregateCount(values []float64) (float64, error) {
+	return float64(len(values)), nil
+}
+
+// matrixTranspose returns the transpose of a matrix. A list becomes a column;
+// an empty list has no transpose.
+func matrixTranspose(args []Value) (Value, error) {
+	if args[0].Kind == ScalarValue {
+		return args[0], nil
+	}
+	if len(args[0].elements()) == 0 {
+		return Value{}, &DimensionError{Left: args[0].shape()}
+	}
+	return Matrix(transpose(toMatrix(args[0]))), nil
+}
+
+// matrixDet returns the determinant of a square matrix.
+func matrixDet(args []Value) (Value, error) {
+	m, err := squareMatrix(args[0])
+	if err != nil {
+		return Value{}, err
+	}
+	return Scalar(determinant(m)), nil
+}
+
+// matrixInv returns the inverse of a square matrix.
+func matrixInv(args []Value) (Value, error) {
+	m, err := squareMatrix(args[0])
+	if err != nil {
+		return Value{}, err
+	}
+	inverse, err := gaussJordan(m, identity(len(m)))
+	if err != nil {
+		return Value{}, err
+	}
+	if args[0].Kind == ScalarValue {
+		return Scalar(inverse[0][0]), nil
+	}
+	return Matrix(inverse), nil
+}
+
+// matrixSolve solves the linear system A·x = b. The right-hand side b is a
+// list with one element per row of A, or a matrix with one row per row of A
+// to solve for several right-hand sides at once.
+func matrixSolve(args []Value) (Value, error) {
+	a, b := args[0], args[1]
+
+	m, err := squareMatrix(a)
+	if err != nil {
+		return Value{}, err
+	}
+
+	var rhs [][]float64
+	switch b.Kind {
+	case ListValue:
+		if len(b.List) > 0 {
+			rhs = transpose([][]float64{b.List})
+		}
+	default:
+		rhs = toMatrix(b)
+	}
+	if len(rhs) != len(m) {
+		return Value{}, &DimensionError{Left: a.shape(), Right: b.shape()}
+	}
+
+	solution, err := gaussJordan(m, rhs)
+	if err != nil {
+		return Value{}, err
+	}
+
+	switch b.Kind {
+	case ListValue:
+		return List(transpose(solution)[0]), nil
+	case MatrixValue:
+		return Matrix(solution), nil
+	default:
+		return Scalar(solution[0][0]), nil
+	}
+}
@@ -0,0 +1,284 @@
+// Package calculation provides a streaming lexer for mathematical expressions.
+package calculation
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/flexer2006/y.lms-sprint2-calculator/common"
+)
+
+// TokenKind classifies a lexical token.
+type TokenKind int
+
+const (
+	// TokenEOF marks the end of input.
+	TokenEOF TokenKind = iota
+	// TokenInvalid marks a character that cannot start any token.
+	TokenInvalid
+	// TokenNumber is a decimal number literal, e.g. 42 or 2.5.
+	TokenNumber
+	// TokenOperator is a binary or prefix operator: + - * / % ^.
+	TokenOperator
+	// TokenPostfix is a postfix operator: ! ² ³.
+	TokenPostfix
+	// TokenLeftParen is an opening parenthesis.
+	TokenLeftParen
+	// TokenRightParen is a closing parenthesis.
+	TokenRightParen
+	// TokenAbs is an absolute-value bar.
+	TokenAbs
+	// TokenLeftBracket opens a list literal.
+	TokenLeftBracket
+	// TokenRightBracket closes a list literal.
+	TokenRightBracket
+	// TokenComma separates list elements and function arguments.
+	TokenComma
+	// TokenRange is the range operator "..".
+	TokenRange
+	// TokenIdent is a function or variable name, e.g. sum.
+	TokenIdent
+)
+
+// String returns a human-readable name of the token kind.
+func (k TokenKind) String() string {
+	switch k {
+	case TokenEOF:
+		return "EOF"
+	case TokenInvalid:
+		return "invalid"
+	case TokenNumber:
+		return "number"
+	case TokenOperator:
+		return "operator"
+	case TokenPostfix:
+		return "postfix operator"
+	case TokenLeftParen:
+		return "left parenthesis"
+	case TokenRightParen:
+		return "right parenthesis"
+	case TokenAbs:
+		return "absolute value bar"
+	case TokenLeftBracket:
+		return "left bracket"
+	case TokenRightBracket:
+		return "right bracket"
+	case TokenComma:
+		return "comma"
+	case TokenRange:
+		return "range"
+	case TokenIdent:
+		return "identifier"
+	default:
+		return fmt.Sprintf("TokenKind(%d)", int(k))
+	}
+}
+
+// Token is a single lexical token of an expression.
+type Token struct {
+	Kind TokenKind // Kind of the token.
+	Text string    // Source text of the token.
+	Pos  int       // Byte offset of the token's first character in the input.
+}
+
+// SyntaxError describes invalid input found by the lexer.
+type SyntaxError struct {
+	Pos  int    // Byte offset of the offending character.
+	Text string // Offending text.
+	Msg  string // Description of the problem.
+}
+
+// Error implements the error interface.
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s %q at position %d", e.Msg, e.Text, e.Pos)
+}
+
+// Lexer splits an expression into tokens, reading its input incrementally.
+// After a *SyntaxError the lexer skips the offending text and may be called
+// again, which lets editors highlight partially typed formulas.
+type Lexer struct {
+	r   *bufio.Reader
+	pos int   // Byte offset of the next unread rune.
+	err error // Sticky read error other than io.EOF.
+}
+
+// NewLexer returns a Lexer reading from r.
+func NewLexer(r io.Reader) *Lexer {
+	return &Lexer{r: bufio.NewReader(r)}
+}
+
+// NewStringLexer returns a Lexer reading from s.
+func NewStringLexer(s string) *Lexer {
+	return NewLexer(strings.NewReader(s))
+}
+
+// Next returns the next token. At the end of input it returns a TokenEOF token
+// and a nil error. An invalid character or malformed number is returned as a
+// TokenInvalid token together with a *SyntaxError.
+func (l *Lexer) Next() (Token, error) {
+	if l.err != nil {
+		return Token{Kind: TokenEOF, Pos: l.pos}, l.err
+	}
+
+	var char rune
+	var start int
+	for {
+		start = l.pos
+		r, err := l.read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return Token{Kind: TokenEOF, Pos: l.pos}, nil
+			}
+			return Token{Kind: TokenEOF, Pos: l.pos}, err
+		}
+		if !unicode.IsSpace(r) {
+			char = r
+			break
+		}
+	}
+
+	switch char {
+	case '+', '-', '*', '/', '%', '^':
+		return Token{Kind: TokenOperator, Text: string(char), Pos: start}, nil
+	case '!', '²', '³':
+		return Token{Kind: TokenPostfix, Text: string(char), Pos: start}, nil
+	case '(':
+		return Token{Kind: TokenLeftParen, Text: "(", Pos: start}, nil
+	case ')':
+		return Token{Kind: TokenRightParen, Text: ")", Pos: start}, nil
+	case '|':
+		return Token{Kind: TokenAbs, Text: "|", Pos: start}, nil
+	case '[':
+		return Token{Kind: TokenLeftBracket, Text: "[", Pos: start}, nil
+	case ']':
+		return Token{Kind: TokenRightBracket, Text: "]", Pos: start}, nil
+	case ',':
+		return Token{Kind: TokenComma, Text: ",", Pos: start}, nil
+	}
+
+	if char == '.' && l.rangeAhead(1) {
+		if _, err := l.read(); err != nil {
+			return Token{Kind: TokenEOF, Pos: l.pos}, err
+		}
+		return Token{Kind: TokenRange, Text: "..", Pos: start}, nil
+	}
+
+	if isDigit(char) || char == '.' {
+		return l.readNumber(char, start)
+	}
+
+	if isIdentStart(char) {
+		return l.readIdent(char, start)
+	}
+
+	return Token{Kind: TokenInvalid, Text: string(char), Pos: start},
+		&SyntaxError{Pos: start, Text: string(char), Msg: common.ErrUnexpectedCharacter}
+}
+
+// readNumber reads the rest of a number literal that starts with first.
+func (l *Lexer) readNumber(first rune, start int) (Token, error) {
+	var number strings.Builder
+	number.WriteRune(first)
+
+	for {
+		r, err := l.peek()
+		if err != nil || !(isDigit(r) || r == '.') || l.rangeAhead(0) {
+			break
+		}
+		if _, err := l.read(); err != nil {
+			return Token{Kind: TokenEOF, Pos: l.pos}, err
+		}
+		number.WriteRune(r)
+	}
+
+	text := number.String()
+	if _, err := strconv.ParseFloat(text, 64); errors.Is(err, strconv.ErrSyntax) {
+		return Token{Kind: TokenInvalid, Text: text, Pos: start},
+			&SyntaxError{Pos: start, Text: text, Msg: common.ErrMalformedNumber}
+	}
+	return Token{Kind: TokenNumber, Text: text, Pos: start}, nil
+}
+
+// readIdent reads the rest of an identifier that starts with first.
+func (l *Lexer) readIdent(first rune, start int) (Token, error) {
+	var ident strings.Builder
+	ident.WriteRune(first)
+
+	for {
+		r, err := l.peek()
+		if err != nil || !(isIdentStart(r) || isDigit(r)) {
+			break
+		}
+		if _, err := l.read(); err != nil {
+			return Token{Kind: TokenEOF, Pos: l.pos}, err
+		}
+		ident.WriteRune(r)
+	}
+
+	return Token{Kind: TokenIdent, Text: ident.String(), Pos: start}, nil
+}
+
+// rangeAhead reports whether the unread input continues a range operator,
+// given that consumed dots of it have already been read.
+func (l *Lexer) rangeAhead(consumed int) bool {
+	want := 2 - consumed
+	next, err := l.r.Peek(want)
+	return err == nil && string(next) == strings.Repeat(".", want)
+}
+
+// read consumes the next rune and advances the position.
+func (l *Lexer) read() (rune, error) {
+	r, size, err := l.r.ReadRune()
+	if err != nil {
+		if !errors.Is(err, io.EOF) {
+			l.err = err
+		}
+		return 0, err
+	}
+	l.pos += size
+	return r, nil
+}
+
+// peek returns the next rune without consuming it.
+func (l *Lexer) peek() (rune, error) {
+	r, _, err := l.r.ReadRune()
+	if err != nil {
+		return 0, err
+	}
+	if err := l.r.UnreadRune(); err != nil {
+		return 0, err
+	}
+	return r, nil
+}
+
+// tokenize splits an expression string into tokens, stopping at the first invalid character.
+func tokenize(expression string) ([]Token, error) {
+	var tokens []Token
+	lexer := NewStringLexer(expression)
+
+	for {
+		token, err := lexer.Next()
+		if err != nil {
+			return nil, err
+		}
+		if token.Kind == TokenEOF {
+			return tokens, nil
+		}
+		tokens = append(tokens, token)
+	}
+}
+
+// isDigit checks if a rune is a digit.
+func isDigit(c rune) bool {
+	return c >= '0' && c <= '9'
+}
+
+// isIdentStart checks if a rune may start an identifier.
+func isIdentStart(c rune) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+}
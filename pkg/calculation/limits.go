@@ -0,0 +1,126 @@
+// Package calculation provides resource limits for expression evaluation.
+package calculation
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/flexer2006/y.lms-sprint2-calculator/common"
+)
+
+// DefaultMaxListElements caps the size of lists and ranges when MaxElements is zero,
+// since their elements are allocated up front.
+const DefaultMaxListElements = 1 << 24
+
+// Limits bounds the resources a single evaluation may consume.
+// A zero field means the corresponding resource is unlimited, except that
+// lists and ranges never exceed DefaultMaxListElements.
+type Limits struct {
+	MaxDepth     int     // Maximum nesting depth of parentheses, bars, unary minus and exponents.
+	MaxTokens    int     // Maximum number of tokens in the expression.
+	MaxLength    int     // Maximum length of the expression in bytes.
+	MaxMagnitude float64 // Maximum absolute value of any literal or intermediate result.
+	MaxElements  int     // Maximum number of elements in a list or range.
+}
+
+// Sentinel errors wrapped by LimitError, usable with errors.Is.
+var (
+	ErrMaxLengthExceeded    = errors.New(common.ErrMaxLengthExceeded)
+	ErrMaxTokensExceeded    = errors.New(common.ErrMaxTokensExceeded)
+	ErrMaxDepthExceeded     = errors.New(common.ErrMaxDepthExceeded)
+	ErrMaxMagnitudeExceeded = errors.New(common.ErrMaxMagnitudeExceeded)
+	ErrMaxElementsExceeded  = errors.New(common.ErrMaxElementsExceeded)
+)
+
+// LimitError reports that evaluation was aborted because a limit was exceeded.
+type LimitError struct {
+	Err   error   // One of the ErrMax* sentinel errors.
+	Limit float64 // Configured limit.
+	Value float64 // Observed value that exceeded the limit.
+}
+
+// Error implements the error interface.
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%v: %g exceeds limit %g", e.Err, e.Value, e.Limit)
+}
+
+// Unwrap returns the sentinel error describing which limit was exceeded.
+func (e *LimitError) Unwrap() error {
+	return e.Err
+}
+
+// CanceledError reports that evaluation was aborted because its context was done.
+type CanceledError struct {
+	Err error // The context error, context.Canceled or context.DeadlineExceeded.
+}
+
+// Error implements the error interface.
+func (e *CanceledError) Error() string {
+	return fmt.Sprintf("%s: %v", common.ErrEvaluationCanceled, e.Err)
+}
+
+// Unwrap returns the underlying context error.
+func (e *CanceledError) Unwrap() error {
+	return e.Err
+}
+
+// checkInput validates the raw expression against the length limit.
+func (l Limits) checkInput(expression string) error {
+	if l.MaxLength > 0 && len(expression) > l.MaxLength {
+		return &LimitError{Err: ErrMaxLengthExceeded, Limit: float64(l.MaxLength), Value: float64(len(expression))}
+	}
+	return nil
+}
+
+// checkTokens validates the token count against the token limit.
+func (l Limits) checkTokens(count int) error {
+	if l.MaxTokens > 0 && count > l.MaxTokens {
+		return &LimitError{Err: ErrMaxTokensExceeded, Limit: float64(l.MaxTokens), Value: float64(count)}
+	}
+	return nil
+}
+
+// checkMagnitude validates a literal or intermediate result against the magnitude limit.
+func (l Limits) checkMagnitude(value float64) error {
+	if l.MaxMagnitude > 0 && math.Abs(value) > l.MaxMagnitude {
+		return &LimitError{Err: ErrMaxMagnitudeExceeded, Limit: l.MaxMagnitude, Value: math.Abs(value)}
+	}
+	return nil
+}
+
+// checkElements validates the size of a list or range against the element limit.
+func (l Limits) checkElements(count float64) error {
+	if l.MaxElements > 0 && count > float64(l.MaxElements) {
+		return &LimitError{Err: ErrMaxElementsExceeded, Limit: float64(l.MaxElements), Value: count}
+	}
+	return nil
+}
+
+// checkListElements validates the size of a list or range that is about to be
+// allocated, falling back to DefaultMaxListElements when no element limit is set.
+func (l Limits) checkListElements(count float64) error {
+	if l.MaxElements == 0 && count > DefaultMaxListElements {
+		return &LimitError{Err: ErrMaxElementsExceeded, Limit: DefaultMaxListElements, Value: count}
+	}
+	return l.checkElements(count)
+}
+
+// enter records one more level of nesting, checking the depth limit and the context.
+// Every successful call must be paired with leave.
+func (p *Parser) enter() error {
+	if err := p.ctx.Err(); err != nil {
+		return &CanceledError{Err: err}
+	}
+	p.depth++
+	if p.limits.MaxDepth > 0 && p.depth > p.limits.MaxDepth {
+		p.depth--
+		return &LimitError{Err: ErrMaxDepthExceeded, Limit: float64(p.limits.MaxDepth), Value: float64(p.depth + 1)}
+	}
+	return nil
+}
+
+// leave undoes one enter.
+func (p *Parser) leave() {
+	p.depth--
+}
@@ -0,0 +1,244 @@
+// Package calculation provides vector and matrix arithmetic.
+package calculation
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/flexer2006/y.lms-sprint2-calculator/common"
+)
+
+// singularTolerance is the pivot size, relative to the largest element of a
+// matrix, below which the matrix is treated as singular.
+const singularTolerance = 1e-12
+
+// DimensionError reports operands whose shapes do not fit an operator or function.
+type DimensionError struct {
+	Op    string // Operator or function name.
+	Pos   int    // Byte offset of the operator or function name in the expression.
+	Left  string // Shape of the first operand: "scalar", a list length or rows x columns.
+	Right string // Shape of the second operand; empty for single-argument functions.
+}
+
+// Error implements the error interface.
+func (e *DimensionError) Error() string {
+	if e.Right == "" {
+		return fmt.Sprintf("%s for %q at position %d: %s", common.ErrDimensionMismatch, e.Op, e.Pos, e.Left)
+	}
+	return fmt.Sprintf("%s for %q at position %d: %s and %s", common.ErrDimensionMismatch, e.Op, e.Pos, e.Left, e.Right)
+}
+
+// operate applies a binary operator to two values. Multiplying a matrix by a
+// matrix or a list is the matrix product, with the list acting as a row vector
+// on the left and a column vector on the right; every other combination is
+// element-wise. Dimension errors point at op.
+func operate(op Token, a, b Value) (Value, error) {
+	hasMatrix := a.Kind == MatrixValue || b.Kind == MatrixValue
+
+	var (
+		result Value
+		err    error
+	)
+	switch {
+	case hasMatrix && op.Text == "*" && a.Kind != ScalarValue && b.Kind != ScalarValue:
+		result, err = matrixProduct(a, b)
+	case hasMatrix && (op.Text == "^" || b.Kind != ScalarValue && (op.Text == "/" || op.Text == "%")):
+		return Value{}, matrixOperatorError(op)
+	default:
+		result, err = binaryValue(a, b, func(x, y float64) (float64, error) {
+			return applyOperator(op.Text, x, y)
+		})
+	}
+
+	var dimErr *DimensionError
+	if errors.As(err, &dimErr) {
+		dimErr.Op, dimErr.Pos = op.Text, op.Pos
+	}
+	return result, err
+}
+
+// matrixOperatorError reports an operator that has no meaning for matrices.
+func matrixOperatorError(op Token) error {
+	return fmt.Errorf("%s: %q at position %d", common.ErrMatrixOperator, op.Text, op.Pos)
+}
+
+// matrixProduct multiplies a by b, at least one of which is a matrix and neither a scalar.
+func matrixProduct(a, b Value) (Value, error) {
+	left, right := productOperands(a, b)
+	if len(left[0]) != len(right) {
+		return Value{}, &DimensionError{Left: a.shape(), Right: b.shape()}
+	}
+
+	product := multiply(left, right)
+	switch {
+	case a.Kind == ListValue:
+		return List(product[0]), nil
+	case b.Kind == ListValue:
+		return List(transpose(product)[0]), nil
+	default:
+		return Matrix(product), nil
+	}
+}
+
+// productOperands converts the operands of a matrix product into matrices:
+// a list is a row vector on the left and a column vector on the right.
+func productOperands(a, b Value) ([][]float64, [][]float64) {
+	left, right := a.Matrix, b.Matrix
+	if a.Kind == ListValue {
+		left = [][]float64{a.List}
+	}
+	if b.Kind == ListValue {
+		right = transpose([][]float64{b.List})
+	}
+	return left, right
+}
+
+// multiply returns the product of an n×k and a k×m matrix.
+func multiply(a, b [][]float64) [][]float64 {
+	result := make([][]float64, len(a))
+	for i := range a {
+		result[i] = make([]float64, len(b[0]))
+		for j := range b[0] {
+			var sum float64
+			for k := range b {
+				sum += a[i][k] * b[k][j]
+			}
+			result[i][j] = sum
+		}
+	}
+	return result
+}
+
+// transpose returns the transpose of a non-empty matrix.
+func transpose(m [][]float64) [][]float64 {
+	result := make([][]float64, len(m[0]))
+	for j := range result {
+		result[j] = make([]float64, len(m))
+		for i := range m {
+			result[j][i] = m[i][j]
+		}
+	}
+	return result
+}
+
+// toMatrix views a value as a matrix: a scalar is 1×1 and a list is a single row.
+func toMatrix(v Value) [][]float64 {
+	switch v.Kind {
+	case ListValue:
+		return [][]float64{v.List}
+	case MatrixValue:
+		return v.Matrix
+	default:
+		return [][]float64{{v.Scalar}}
+	}
+}
+
+// squareMatrix returns v as a square matrix or a *DimensionError.
+func squareMatrix(v Value) ([][]float64, error) {
+	m := toMatrix(v)
+	if len(m) == 0 || len(m[0]) != len(m) {
+		return nil, &DimensionError{Left: v.shape()}
+	}
+	return m, nil
+}
+
+// copyMatrix returns a deep copy of m.
+func copyMatrix(m [][]float64) [][]float64 {
+	result := make([][]float64, len(m))
+	for i, row := range m {
+		result[i] = append([]float64(nil), row...)
+	}
+	return result
+}
+
+// identity returns the n×n identity matrix.
+func identity(n int) [][]float64 {
+	result := make([][]float64, n)
+	for i := range result {
+		result[i] = make([]float64, n)
+		result[i][i] = 1
+	}
+	return result
+}
+
+// determinant computes the determinant of a square matrix by Gaussian
+// elimination with partial pivoting.
+func determinant(m [][]float64) float64 {
+	a := copyMatrix(m)
+	det := 1.0
+
+	for col := range a {
+		pivot := col
+		for row := col + 1; row < len(a); row++ {
+			if math.Abs(a[row][col]) > math.Abs(a[pivot][col]) {
+				pivot = row
+			}
+		}
+		if a[pivot][col] == 0 {
+			return 0
+		}
+		if pivot != col {
+			a[pivot], a[col] = a[col], a[pivot]
+			det = -det
+		}
+
+		det *= a[col][col]
+		for row := col + 1; row < len(a); row++ {
+			factor := a[row][col] / a[col][col]
+			for k := col; k < len(a); k++ {
+				a[row][k] -= factor * a[col][k]
+			}
+		}
+	}
+	return det
+}
+
+// gaussJordan solves a·X = b for X, where a is square and b has as many rows
+// as a, by Gauss-Jordan elimination with partial pivoting.
+func gaussJordan(a, b [][]float64) ([][]float64, error) {
+	a, b = copyMatrix(a), copyMatrix(b)
+
+	var scale float64
+	for _, row := range a {
+		for _, x := range row {
+			scale = math.Max(scale, math.Abs(x))
+		}
+	}
+
+	for col := range a {
+		pivot := col
+		for row := col + 1; row < len(a); row++ {
+			if math.Abs(a[row][col]) > math.Abs(a[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(a[pivot][col]) <= singularTolerance*scale {
+			return nil, errors.New(common.ErrSingularMatrix)
+		}
+		a[pivot], a[col] = a[col], a[pivot]
+		b[pivot], b[col] = b[col], b[pivot]
+
+		div := a[col][col]
+		for k := range a[col] {
+			a[col][k] /= div
+		}
+		for k := range b[col] {
+			b[col][k] /= div
+		}
+
+		for row := range a {
+			if row == col || a[row][col] == 0 {
+				continue
+			}
+			factor := a[row][col]
+			for k := range a[row] {
+				a[row][k] -= factor * a[col][k]
+			}
+			for k := range b[row] {
+				b[row][k] -= factor * b[col][k]
+			}
+		}
+	}
+	return b, nil
+}
@@ -0,0 +1,329 @@
+// Package calculation provides translation of arithmetic phrases written in words.
+package calculation
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/flexer2006/y.lms-sprint2-calculator/common"
+)
+
+// numberWordKind tells which places of a number a number word fills.
+type numberWordKind int
+
+const (
+	unitWord     numberWordKind = iota // 0-9: the units.
+	teenWord                           // 10-19: the tens and the units.
+	tensWord                           // 20-90: the tens.
+	hundredsWord                       // Russian 100-900: the hundreds.
+	hundredWord                        // English "hundred": multiplies the units before it.
+	scaleWord                          // Thousand, million, billion: multiplies the group before it.
+)
+
+// numberWord is a word naming a number or a part of one.
+type numberWord struct {
+	value float64
+	kind  numberWordKind
+}
+
+// numberWords maps Russian and English number words to their values.
+var numberWords = map[string]numberWord{
+	"zero": {0, unitWord}, "one": {1, unitWord}, "two": {2, unitWord}, "three": {3, unitWord},
+	"four": {4, unitWord}, "five": {5, unitWord}, "six": {6, unitWord}, "seven": {7, unitWord},
+	"eight": {8, unitWord}, "nine": {9, unitWord},
+	"ten": {10, teenWord}, "eleven": {11, teenWord}, "twelve": {12, teenWord}, "thirteen": {13, teenWord},
+	"fourteen": {14, teenWord}, "fifteen": {15, teenWord}, "sixteen": {16, teenWord},
+	"seventeen": {17, teenWord}, "eighteen": {18, teenWord}, "nineteen": {19, teenWord},
+	"twenty": {20, tensWord}, "thirty": {30, tensWord}, "forty": {40, tensWord}, "fifty": {50, tensWord},
+	"sixty": {60, tensWord}, "seventy": {70, tensWord}, "eighty": {80, tensWord}, "ninety": {90, tensWord},
+	"hundred":  {100, hundredWord},
+	"thousand": {1e3, scaleWord}, "million": {1e6, scaleWord}, "billion": {1e9, scaleWord},
+
+	"ноль": {0, unitWord}, "нуль": {0, unitWord}, "один": {1, unitWord}, "одна": {1, unitWord},
+	"одно": {1, unitWord}, "два": {2, unitWord}, "две": {2, unitWord}, "три": {3, unitWord},
+	"четыре": {4, unitWord}, "пять": {5, unitWord}, "шесть": {6, unitWord}, "семь": {7, unitWord},
+	"восемь": {8, unitWord}, "девять": {9, unitWord},
+	"десять": {10, teenWord}, "одиннадцать": {11, teenWord}, "двенадцать": {12, teenWord},
+	"тринадцать": {13, teenWord}, "четырнадцать": {14, teenWord}, "пятнадцать": {15, teenWord},
+	"шестнадцать": {16, teenWord}, "семнадцать": {17, teenWord}, "восемнадцать": {18, teenWord},
+	"девятнадцать": {19, teenWord},
+	"двадцать":     {20, tensWord}, "тридцать": {30, tensWord}, "сорок": {40, tensWord},
+	"пятьдесят": {50, tensWord}, "шестьдесят": {60, tensWord}, "семьдесят": {70, tensWord},
+	"восемьдесят": {80, tensWord}, "девяносто": {90, tensWord},
+	"сто": {100, hundredsWord}, "двести": {200, hundredsWord}, "триста": {300, hundredsWord},
+	"четыреста": {400, hundredsWord}, "пятьсот": {500, hundredsWord}, "шестьсот": {600, hundredsWord},
+	"семьсот": {700, hundredsWord}, "восемьсот": {800, hundredsWord}, "девятьсот": {900, hundredsWord},
+	"тысяча": {1e3, scaleWord}, "тысячи": {1e3, scaleWord}, "тысяч": {1e3, scaleWord},
+	"миллион": {1e6, scaleWord}, "миллиона": {1e6, scaleWord}, "миллионов": {1e6, scaleWord},
+	"миллиард": {1e9, scaleWord}, "миллиарда": {1e9, scaleWord}, "миллиардов": {1e9, scaleWord},
+}
+
+// decimalPoints are the words separating the integer part of a number from
+// its decimal digits: "three point one four".
+var decimalPoints = map[string]bool{"point": true, "запятая": true, "точка": true}
+
+// wholeWords follow the integer part of a Russian fraction: "две целых пять десятых".
+var wholeWords = map[string]bool{"целая": true, "целых": true, "целые": true}
+
+// fractionWords name the denominator of a Russian fraction.
+var fractionWords = map[string]float64{
+	"десятая": 10, "десятых": 10, "десятые": 10,
+	"сотая": 100, "сотых": 100, "сотые": 100,
+	"тысячная": 1000, "тысячных": 1000, "тысячные": 1000,
+}
+
+// operatorPhrases maps operator words and phrases to symbols. Longer phrases
+// are matched first.
+var operatorPhrases = map[string]string{
+	"plus": "+", "minus": "-", "negative": "-", "times": "*", "multiplied by": "*",
+	"divided by": "/", "over": "/", "mod": "%", "modulo": "%",
+	"to the power of": "^", "raised to the power of": "^", "raised to": "^",
+	"squared": "^ 2", "cubed": "^ 3",
+	"open parenthesis": "(", "open bracket": "(", "left parenthesis": "(",
+	"close parenthesis": ")", "close bracket": ")", "right parenthesis": ")",
+
+	"плюс": "+", "минус": "-", "умножить на": "*", "умноженное на": "*", "помножить на": "*",
+	"разделить на": "/", "делить на": "/", "поделить на": "/", "деленное на": "/",
+	"по модулю": "%", "в степени": "^", "в квадрате": "^ 2", "в кубе": "^ 3",
+	"открыть скобку": "(", "открывающая скобка": "(", "скобка открывается": "(",
+	"закрыть скобку": ")", "закрывающая скобка": ")", "скобка закрывается": ")",
+}
+
+// maxPhraseWords is the number of words in the longest operator phrase.
+const maxPhraseWords = 5
+
+// fillerWords carry no meaning for the calculation and are skipped.
+var fillerWords = map[string]bool{
+	"what": true, "is": true, "equals": true, "calculate": true,
+	"сколько": true, "будет": true, "равно": true, "посчитай": true, "вычисли": true,
+}
+
+// phraseToken is a word, a number written in digits or a symbol of a phrase.
+type phraseToken struct {
+	text string // Lowercase text of the token.
+	pos  int    // Byte offset of the token in the phrase.
+	word bool   // Whether the token consists of letters.
+}
+
+// TranslateNatural translates an arithmetic phrase in Russian or English,
+// such as "двадцать пять умножить на три" or "two plus three times four",
+// into an expression: "25 * 3", "2 + 3 * 4". Number words and operator words
+// are replaced with numbers and symbols; numbers written in digits, symbols
+// and parentheses are kept as they are. Fillers such as "сколько будет" or
+// "what is" and question and equals signs are dropped. The result is not
+// validated: it is parsed like any other expression.
+func TranslateNatural(phrase string) (string, error) {
+	tokens := splitPhrase(phrase)
+
+	var parts []string
+	for i := 0; i < len(tokens); {
+		token := tokens[i]
+		if !token.word {
+			if token.text != "?" && token.text != "=" {
+				parts = append(parts, token.text)
+			}
+			i++
+			continue
+		}
+
+		if symbol, n := matchOperator(tokens[i:]); n > 0 {
+			parts = append(parts, symbol)
+			i += n
+			continue
+		}
+		if fillerWords[token.text] {
+			i++
+			continue
+		}
+		if _, ok := numberWords[token.text]; !ok {
+			return "", fmt.Errorf("%s %q at position %d", common.ErrUnknownWord, token.text, token.pos)
+		}
+
+		value, next, err := parseNumberWords(tokens, i)
+		if err != nil {
+			return "", err
+		}
+		// Without an exponent, which neither the parser nor the orchestrator reads.
+		parts = append(parts, strconv.FormatFloat(value, 'f', -1, 64))
+		i = next
+	}
+
+	if len(parts) == 0 {
+		return "", errors.New(common.ErrEmptyPhrase)
+	}
+	return strings.Join(parts, " "), nil
+}
+
+// splitPhrase splits a phrase into lowercase words, numbers written in
+// digits and single symbols. The letter ё is read as е. A hyphen joining
+// tens and units, as in "sixty-six", is dropped: the words form one number.
+func splitPhrase(phrase string) []phraseToken {
+	var tokens []phraseToken
+	for i := 0; i < len(phrase); {
+		r, size := utf8.DecodeRuneInString(phrase[i:])
+		start := i
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+			continue
+		case r == '-' && joinsCompound(tokens, phrase[i+size:]):
+			i += size
+			continue
+		case unicode.IsLetter(r):
+			for i < len(phrase) {
+				r, size := utf8.DecodeRuneInString(phrase[i:])
+				if !unicode.IsLetter(r) {
+					break
+				}
+				i += size
+			}
+			text := strings.ReplaceAll(strings.ToLower(phrase[start:i]), "ё", "е")
+			tokens = append(tokens, phraseToken{text: text, pos: start, word: true})
+			continue
+		case isDigit(r) || r == '.':
+			for i < len(phrase) && (isDigit(rune(phrase[i])) || phrase[i] == '.') {
+				i++
+			}
+		default:
+			i += size
+		}
+		tokens = append(tokens, phraseToken{text: phrase[start:i], pos: start})
+	}
+	return tokens
+}
+
+// joinsCompound reports whether a hyphen between the last of tokens and rest
+// joins tens and units into a compound number.
+func joinsCompound(tokens []phraseToken, rest string) bool {
+	if len(tokens) == 0 || numberWords[tokens[len(tokens)-1].text].kind != tensWord {
+		return false
+	}
+	end := strings.IndexFunc(rest, func(r rune) bool { return !unicode.IsLetter(r) })
+	if end < 0 {
+		end = len(rest)
+	}
+	next, ok := numberWords[strings.ToLower(rest[:end])]
+	return ok && next.kind == unitWord && next.value != 0
+}
+
+// matchOperator matches the longest operator phrase at the start of tokens
+// and returns its symbol and the number of words it spans, or 0 if none matches.
+func matchOperator(tokens []phraseToken) (string, int) {
+	for n := min(maxPhraseWords, len(tokens)); n > 0; n-- {
+		words := make([]string, 0, n)
+		for _, token := range tokens[:n] {
+			if !token.word {
+				break
+			}
+			words = append(words, token.text)
+		}
+		if len(words) < n {
+			continue
+		}
+		if symbol, ok := operatorPhrases[strings.Join(words, " ")]; ok {
+			return symbol, n
+		}
+	}
+	return "", 0
+}
+
+// parseNumberWords reads the number written in words starting at tokens[i],
+// including its decimal or fractional part, and returns it together with
+// the index of the first token after it.
+func parseNumberWords(tokens []phraseToken, i int) (float64, int, error) {
+	value, i, err := parseIntegerWords(tokens, i)
+	if err != nil || i >= len(tokens) {
+		return value, i, err
+	}
+
+	point := tokens[i]
+	switch {
+	case decimalPoints[point.text]:
+		digits := ""
+		for i++; i < len(tokens); i++ {
+			w, ok := numberWords[tokens[i].text]
+			if !ok || w.kind != unitWord {
+				break
+			}
+			digits += formatNumber(w.value)
+		}
+		if digits == "" {
+			return 0, i, fmt.Errorf("%s %q at position %d", common.ErrMisplacedNumberWord, point.text, point.pos)
+		}
+		fraction, _ := strconv.ParseFloat("0."+digits, 64)
+		return value + fraction, i, nil
+	case wholeWords[point.text]:
+		numerator, next, err := parseIntegerWords(tokens, i+1)
+		if err != nil {
+			return 0, next, err
+		}
+		if next == i+1 || next >= len(tokens) || fractionWords[tokens[next].text] == 0 {
+			return 0, next, fmt.Errorf("%s %q at position %d", common.ErrMisplacedNumberWord, point.text, point.pos)
+		}
+		return value + numerator/fractionWords[tokens[next].text], next + 1, nil
+	}
+	return value, i, nil
+}
+
+// parseIntegerWords reads the whole number written in words starting at
+// tokens[i], such as "two hundred and five" or "двадцать пять тысяч", and
+// returns it together with the index of the first token after it.
+func parseIntegerWords(tokens []phraseToken, i int) (float64, int, error) {
+	var (
+		total, group float64
+		open         = 3 // Highest place of the current group not filled yet: hundreds, tens, units.
+		lastScale    float64
+		started      bool
+	)
+
+	for ; i < len(tokens); i++ {
+		token := tokens[i]
+		if token.text == "and" && started && i+1 < len(tokens) {
+			if _, ok := numberWords[tokens[i+1].text]; ok {
+				continue
+			}
+		}
+		w, ok := numberWords[token.text]
+		if !ok {
+			break
+		}
+
+		var fits bool
+		switch w.kind {
+		case unitWord:
+			fits = open >= 1 && (w.value != 0 || !started)
+			group, open = group+w.value, 0
+		case teenWord:
+			fits = open >= 2
+			group, open = group+w.value, 0
+		case tensWord:
+			fits = open >= 2
+			group, open = group+w.value, 1
+		case hundredsWord:
+			fits = open == 3
+			group, open = group+w.value, 2
+		case hundredWord:
+			if group == 0 && open == 3 {
+				group = 1
+			}
+			fits = group < 100
+			group, open = group*100, 2
+		case scaleWord:
+			if group == 0 && open == 3 {
+				group = 1
+			}
+			fits = lastScale == 0 || w.value < lastScale
+			total += group * w.value
+			group, open, lastScale = 0, 3, w.value
+		}
+		if !fits {
+			return 0, i, fmt.Errorf("%s %q at position %d", common.ErrMisplacedNumberWord, token.text, token.pos)
+		}
+		started = true
+	}
+	return total + group, i, nil
+}
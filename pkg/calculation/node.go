@@ -0,0 +1,189 @@
+// Package calculation provides the expression tree built by the parser.
+package calculation
+
+import (
+	"math"
+	"strings"
+)
+
+// nodeKind classifies an expression tree node.
+type nodeKind int
+
+const (
+	valueNode    nodeKind = iota // A number literal or an already computed value.
+	unaryNode                    // Prefix minus.
+	absNode                      // Absolute value bars.
+	postfixNode                  // Factorial, ² or ³.
+	binaryNode                   // Binary arithmetic operator.
+	rangeNode                    // Inclusive range a..b.
+	listNode                     // List or matrix literal.
+	callNode                     // Function call.
+	variableNode                 // Reference to a bound variable.
+	boundNode                    // Construct with a bound variable: sum, prod or integrate.
+)
+
+// Operator precedence levels, from loosest to tightest, used to print
+// an expression with the minimum number of parentheses.
+const (
+	precRange = iota
+	precSum
+	precProduct
+	precUnary
+	precPower
+	precPostfix
+	precAtom
+)
+
+// node is a node of an expression tree.
+type node struct {
+	kind     nodeKind
+	token    Token   // Operator, function or variable name, opening bracket or literal.
+	value    Value   // Value of a valueNode.
+	spread   bool    // A valueNode computed from a range, spliced into an enclosing list.
+	variable string  // Variable bound by a boundNode.
+	args     []*node // Operands, arguments or list elements; a boundNode has lower, upper and body.
+}
+
+// isRange reports whether the node is a range, evaluated or not.
+func (n *node) isRange() bool {
+	return n.kind == rangeNode || n.spread
+}
+
+// redex returns the leftmost innermost node whose operands are all values,
+// which is the next node evaluation reduces. It returns nil for a value.
+// The body of a construct with a bound variable is reduced as a whole.
+func (n *node) redex() *node {
+	if n.kind == valueNode {
+		return nil
+	}
+	args := n.args
+	if n.kind == boundNode {
+		args = args[:2]
+	}
+	for _, arg := range args {
+		if arg.kind != valueNode {
+			return arg.redex()
+		}
+	}
+	return n
+}
+
+// reduceTo replaces the node with its computed value.
+func (n *node) reduceTo(v Value) {
+	*n = node{kind: valueNode, token: n.token, value: v, spread: n.isRange()}
+}
+
+// precedence returns the binding strength of the node when printed.
+func (n *node) precedence() int {
+	switch n.kind {
+	case valueNode:
+		if n.value.Kind == ScalarValue && math.Signbit(n.value.Scalar) {
+			return precUnary
+		}
+		return precAtom
+	case unaryNode:
+		return precUnary
+	case postfixNode:
+		return precPostfix
+	case binaryNode:
+		switch n.token.Text {
+		case "+", "-":
+			return precSum
+		case "^":
+			return precPower
+		default:
+			return precProduct
+		}
+	case rangeNode:
+		return precRange
+	default:
+		return precAtom
+	}
+}
+
+// String prints the expression with the minimum number of parentheses.
+func (n *node) String() string {
+	var b strings.Builder
+	n.write(&b)
+	return b.String()
+}
+
+// write prints the node to b.
+func (n *node) write(b *strings.Builder) {
+	switch n.kind {
+	case valueNode:
+		b.WriteString(n.value.String())
+	case unaryNode:
+		b.WriteString("-")
+		n.args[0].writeOperand(b, precUnary)
+	case absNode:
+		b.WriteString("|")
+		n.args[0].write(b)
+		b.WriteString("|")
+	case postfixNode:
+		n.args[0].writeOperand(b, precAtom)
+		b.WriteString(n.token.Text)
+	case binaryNode:
+		left, right := n.precedence(), n.precedence()+1
+		switch {
+		case n.token.Text == "^":
+			// Right-associative: the base binds tighter than ^, the exponent may carry a sign.
+			left, right = precPostfix, precUnary
+		case n.args[1].precedence() == precUnary:
+			// A signed right operand is parenthesized for readability: 2-(-1), not 2--1.
+			right = precPower
+		}
+		n.args[0].writeOperand(b, left)
+		b.WriteString(n.token.Text)
+		n.args[1].writeOperand(b, right)
+	case rangeNode:
+		n.args[0].writeOperand(b, precSum)
+		b.WriteString("..")
+		n.args[1].writeOperand(b, precSum)
+	case listNode:
+		b.WriteString("[")
+		n.writeArgs(b)
+		b.WriteString("]")
+	case callNode:
+		b.WriteString(n.token.Text)
+		b.WriteString("(")
+		n.writeArgs(b)
+		b.WriteString(")")
+	case variableNode:
+		b.WriteString(n.token.Text)
+	case boundNode:
+		b.WriteString(n.token.Text)
+		b.WriteString("(")
+		b.WriteString(n.variable)
+		b.WriteString(", ")
+		n.writeArgs(b)
+		b.WriteString(")")
+	}
+}
+
+// writeOperand prints the node, in parentheses if it binds looser than level.
+func (n *node) writeOperand(b *strings.Builder, level int) {
+	if n.precedence() >= level {
+		n.write(b)
+		return
+	}
+	b.WriteString("(")
+	n.write(b)
+	b.WriteString(")")
+}
+
+// writeArgs prints the arguments or elements of the node separated by commas.
+// An evaluated range inside a list is printed as its elements.
+func (n *node) writeArgs(b *strings.Builder) {
+	for i, arg := range n.args {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		if n.kind == listNode && arg.spread {
+			list := arg.value.String()
+			b.WriteString(list[1 : len(list)-1])
+			continue
+		}
+		arg.write(b)
+	}
+}
@@ -2,9 +2,9 @@
 package calculation
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"math"
 	"strconv"
 
 	"github.com/flexer2006/y.lms-sprint2-calculator/common"
@@ -13,179 +13,373 @@ import (
 
 // Parser represents a mathematical expression parser.
 type Parser struct {
-	tokens []string // Tokens of the expression to be parsed.
-	pos    int      // Current position in the tokens slice.
+	tokens []Token         // Tokens of the expression to be parsed.
+	pos    int             // Current position in the tokens slice.
+	ctx    context.Context // Context checked for cancellation while parsing.
+	limits Limits          // Resource limits enforced while parsing.
+	depth  int             // Current nesting depth.
+	scope  []string        // Variables bound by the enclosing constructs.
 }
 
-// parse evaluates the entire expression and returns the result.
+// parse parses the entire expression into a tree.
 // It ensures that all tokens are consumed and returns an error if unexpected tokens remain.
-func (p *Parser) parse() (float64, error) {
-	result, err := p.parseExpression()
+func (p *Parser) parse() (*node, error) {
+	result, err := p.parseRange()
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 	if p.pos < len(p.tokens) {
-		return 0, errors.New(common.ErrUnexpectedToken)
+		token := p.tokens[p.pos]
+		return nil, fmt.Errorf("%s %q at position %d", common.ErrUnexpectedToken, token.Text, token.Pos)
 	}
 	return result, nil
 }
 
+// texts returns the source text of every token, for logging.
+func (p *Parser) texts() []string {
+	texts := make([]string, len(p.tokens))
+	for i, token := range p.tokens {
+		texts[i] = token.Text
+	}
+	return texts
+}
+
+// peekKind reports whether the current token has the given kind.
+func (p *Parser) peekKind(kind TokenKind) bool {
+	return p.pos < len(p.tokens) && p.tokens[p.pos].Kind == kind
+}
+
+// parseRange parses an expression optionally followed by .. and an upper bound.
+func (p *Parser) parseRange() (*node, error) {
+	start, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	if !p.peekKind(TokenRange) {
+		return start, nil
+	}
+	op := p.tokens[p.pos]
+	p.pos++
+
+	end, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	return &node{kind: rangeNode, token: op, args: []*node{start, end}}, nil
+}
+
 // parseExpression parses addition and subtraction operations.
-func (p *Parser) parseExpression() (float64, error) {
+func (p *Parser) parseExpression() (*node, error) {
 	left, err := p.parseTerm()
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
 	for p.pos < len(p.tokens) {
 		op := p.tokens[p.pos]
-		if op != "+" && op != "-" {
+		if op.Text != "+" && op.Text != "-" {
 			break
 		}
 		p.pos++
 
 		right, err := p.parseTerm()
 		if err != nil {
-			return 0, err
-		}
-
-		if op == "+" {
-			left += right
-		} else {
-			left -= right
+			return nil, err
 		}
+		left = &node{kind: binaryNode, token: op, args: []*node{left, right}}
 	}
 
 	return left, nil
 }
 
 // parseTerm parses multiplication, division, and modulo operations.
-func (p *Parser) parseTerm() (float64, error) {
-	left, err := p.parsePower()
+func (p *Parser) parseTerm() (*node, error) {
+	left, err := p.parseUnary()
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
 	for p.pos < len(p.tokens) {
 		op := p.tokens[p.pos]
-		if op != "*" && op != "/" && op != "%" {
+		if op.Text != "*" && op.Text != "/" && op.Text != "%" {
 			break
 		}
 		p.pos++
 
-		right, err := p.parsePower()
+		right, err := p.parseUnary()
 		if err != nil {
-			return 0, err
+			return nil, err
 		}
+		left = &node{kind: binaryNode, token: op, args: []*node{left, right}}
+	}
 
-		switch op {
-		case "*":
-			left *= right
-		case "/":
-			if right == 0 {
-				return 0, errors.New(common.ErrDivisionByZero)
-			}
-			left /= right
-		case "%":
-			if right == 0 {
-				return 0, errors.New(common.ErrModuloByZero)
-			}
-			if left != float64(int(left)) || right != float64(int(right)) {
-				return 0, errors.New(common.ErrInvalidModulo)
+	return left, nil
+}
+
+// parseUnary parses prefix minus. It binds looser than exponentiation and
+// postfix operators, so -2^2 is -(2^2) and -3! is -(3!).
+func (p *Parser) parseUnary() (*node, error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+
+	if p.pos < len(p.tokens) && p.tokens[p.pos].Text == "-" {
+		op := p.tokens[p.pos]
+		p.pos++
+
+		operand, err := p.parseUnary()
+		if err != nil {
+			if logger != nil {
+				logger.Error(common.LogFailedParseNegative,
+					zap.Error(err),
+					zap.Strings(common.FieldTokens, p.texts()),
+					zap.Int(common.FieldPosition, p.pos))
 			}
-			left = math.Mod(left, right)
+			return nil, err
 		}
+		return &node{kind: unaryNode, token: op, args: []*node{operand}}, nil
 	}
 
-	return left, nil
+	return p.parsePower()
 }
 
 // parsePower parses exponentiation operations.
-func (p *Parser) parsePower() (float64, error) {
-	result, err := p.parseFactor()
+// The exponent may carry its own unary minus, as in 2^-1.
+func (p *Parser) parsePower() (*node, error) {
+	result, err := p.parsePostfix()
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
-	if p.pos < len(p.tokens) && p.tokens[p.pos] == "^" {
+	if p.pos < len(p.tokens) && p.tokens[p.pos].Text == "^" {
+		op := p.tokens[p.pos]
 		p.pos++
 
-		exponent, err := p.parsePower()
+		exponent, err := p.parseUnary()
 		if err != nil {
-			return 0, err
+			return nil, err
 		}
-		result = math.Pow(result, exponent)
+		return &node{kind: binaryNode, token: op, args: []*node{result, exponent}}, nil
+	}
+
+	return result, nil
+}
+
+// parsePostfix parses postfix operators: factorial and the ² and ³ powers.
+// Postfix operators bind tighter than ^, so 2^3! is 2^(3!).
+func (p *Parser) parsePostfix() (*node, error) {
+	result, err := p.parseFactor()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peekKind(TokenPostfix) {
+		result = &node{kind: postfixNode, token: p.tokens[p.pos], args: []*node{result}}
+		p.pos++
 	}
 
 	return result, nil
 }
 
-// parseFactor parses individual factors, including numbers, parentheses, and negative signs.
-func (p *Parser) parseFactor() (float64, error) {
+// parseFactor parses individual factors: numbers, parentheses, absolute-value
+// bars, list literals and function calls.
+func (p *Parser) parseFactor() (*node, error) {
 	if p.pos >= len(p.tokens) {
 		if logger != nil {
 			logger.Error(common.LogUnexpectedEndExpr,
-				zap.Strings(common.FieldTokens, p.tokens),
+				zap.Strings(common.FieldTokens, p.texts()),
 				zap.Int(common.FieldPosition, p.pos))
 		}
-		return 0, errors.New(common.ErrUnexpectedEndExpr)
+		return nil, errors.New(common.ErrUnexpectedEndExpr)
 	}
 
 	token := p.tokens[p.pos]
 	p.pos++
 
-	switch {
-	case token == "(":
-		result, err := p.parseExpression()
+	switch token.Kind {
+	case TokenLeftParen:
+		result, err := p.parseRange()
 		if err != nil {
 			if logger != nil {
 				logger.Error(common.LogFailedParseParentheses,
 					zap.Error(err),
-					zap.Strings(common.FieldTokens, p.tokens),
+					zap.Strings(common.FieldTokens, p.texts()),
 					zap.Int(common.FieldPosition, p.pos))
 			}
-			return 0, err
+			return nil, err
 		}
-		if p.pos >= len(p.tokens) || p.tokens[p.pos] != ")" {
+		if !p.peekKind(TokenRightParen) {
 			if logger != nil {
 				logger.Error(common.LogMissingCloseParen,
-					zap.Strings(common.FieldTokens, p.tokens),
+					zap.Strings(common.FieldTokens, p.texts()),
 					zap.Int(common.FieldPosition, p.pos))
 			}
-			return 0, errors.New(common.ErrMissingCloseParen)
+			return nil, errors.New(common.ErrMissingCloseParen)
 		}
 		p.pos++
 		return result, nil
-	case token == "-":
-		factor, err := p.parseFactor()
+	case TokenAbs:
+		result, err := p.parseRange()
 		if err != nil {
 			if logger != nil {
-				logger.Error(common.LogFailedParseNegative,
+				logger.Error(common.LogFailedParseAbs,
 					zap.Error(err),
-					zap.Strings(common.FieldTokens, p.tokens),
+					zap.Strings(common.FieldTokens, p.texts()),
 					zap.Int(common.FieldPosition, p.pos))
 			}
-			return 0, err
+			return nil, err
 		}
-		return -factor, nil
-	case isNumber(token):
-		num, err := strconv.ParseFloat(token, 64)
+		if !p.peekKind(TokenAbs) {
+			if logger != nil {
+				logger.Error(common.LogMissingCloseAbs,
+					zap.Strings(common.FieldTokens, p.texts()),
+					zap.Int(common.FieldPosition, p.pos))
+			}
+			return nil, errors.New(common.ErrMissingCloseAbs)
+		}
+		p.pos++
+		return &node{kind: absNode, token: token, args: []*node{result}}, nil
+	case TokenLeftBracket:
+		return p.parseList(token)
+	case TokenIdent:
+		return p.parseCall(token)
+	case TokenNumber:
+		num, err := strconv.ParseFloat(token.Text, 64)
 		if err != nil {
 			if logger != nil {
 				logger.Error(common.LogInvalidNumberFormat,
-					zap.String(common.FieldToken, token),
+					zap.String(common.FieldToken, token.Text),
 					zap.Error(err))
 			}
-			return 0, fmt.Errorf("invalid number: %s", token)
+			return nil, fmt.Errorf("invalid number: %s", token.Text)
+		}
+		if err := p.limits.checkMagnitude(num); err != nil {
+			return nil, err
 		}
-		return num, nil
+		return &node{kind: valueNode, token: token, value: Scalar(num)}, nil
 	default:
 		if logger != nil {
 			logger.Error(common.LogUnexpectedToken,
-				zap.String(common.FieldToken, token),
-				zap.Strings(common.FieldTokens, p.tokens),
+				zap.String(common.FieldToken, token.Text),
+				zap.Strings(common.FieldTokens, p.texts()),
 				zap.Int(common.FieldPosition, p.pos))
 		}
-		return 0, fmt.Errorf("unexpected token: %s", token)
+		return nil, fmt.Errorf("unexpected token %q at position %d", token.Text, token.Pos)
+	}
+}
+
+// parseList parses a list or matrix literal after its opening bracket.
+func (p *Parser) parseList(open Token) (*node, error) {
+	list := &node{kind: listNode, token: open}
+
+	for !p.peekKind(TokenRightBracket) {
+		element, err := p.parseRange()
+		if err != nil {
+			return nil, err
+		}
+		list.args = append(list.args, element)
+
+		if !p.peekKind(TokenComma) {
+			break
+		}
+		p.pos++
+		if p.peekKind(TokenRightBracket) {
+			return nil, fmt.Errorf("%s \"]\" at position %d", common.ErrUnexpectedToken, p.tokens[p.pos].Pos)
+		}
+	}
+
+	if !p.peekKind(TokenRightBracket) {
+		return nil, fmt.Errorf("%s at position %d", common.ErrMissingCloseBracket, open.Pos)
+	}
+	p.pos++
+	return list, nil
+}
+
+// parseCall parses a function call or a variable reference after a name.
+func (p *Parser) parseCall(name Token) (*node, error) {
+	if !p.peekKind(TokenLeftParen) {
+		if !p.isBound(name.Text) {
+			return nil, fmt.Errorf("%s %q at position %d", common.ErrUnknownVariable, name.Text, name.Pos)
+		}
+		return &node{kind: variableNode, token: name}, nil
+	}
+	if !isFunction(name.Text) {
+		return nil, fmt.Errorf("%s %q at position %d", common.ErrUnknownFunction, name.Text, name.Pos)
+	}
+	p.pos++
+
+	if boundConstructs[name.Text] {
+		if p.pos+1 < len(p.tokens) && p.tokens[p.pos].Kind == TokenIdent && p.tokens[p.pos+1].Kind == TokenComma {
+			return p.parseBound(name)
+		}
+		if _, isAggregate := aggregates[name.Text]; !isAggregate {
+			return nil, fmt.Errorf("%s: %s at position %d", name.Text, common.ErrConstructArguments, name.Pos)
+		}
+	}
+
+	call := &node{kind: callNode, token: name}
+	for !p.peekKind(TokenRightParen) {
+		arg, err := p.parseRange()
+		if err != nil {
+			return nil, err
+		}
+		call.args = append(call.args, arg)
+
+		if !p.peekKind(TokenComma) {
+			break
+		}
+		p.pos++
+		if p.peekKind(TokenRightParen) {
+			return nil, fmt.Errorf("%s \")\" at position %d", common.ErrUnexpectedToken, p.tokens[p.pos].Pos)
+		}
+	}
+
+	if !p.peekKind(TokenRightParen) {
+		return nil, errors.New(common.ErrMissingCloseParen)
+	}
+	p.pos++
+	return call, nil
+}
+
+// parseBound parses the arguments of a construct with a bound variable,
+// name(variable, lower, upper, body), after the opening parenthesis.
+func (p *Parser) parseBound(name Token) (*node, error) {
+	variable := p.tokens[p.pos]
+	p.pos += 2
+
+	bound := &node{kind: boundNode, token: name, variable: variable.Text}
+	for i := 0; i < 3; i++ {
+		if i == 2 {
+			p.scope = append(p.scope, variable.Text)
+		}
+		arg, err := p.parseRange()
+		if i == 2 {
+			p.scope = p.scope[:len(p.scope)-1]
+		}
+		if err != nil {
+			return nil, err
+		}
+		bound.args = append(bound.args, arg)
+
+		separator := TokenComma
+		if i == 2 {
+			separator = TokenRightParen
+		}
+		if !p.peekKind(separator) {
+			return nil, fmt.Errorf("%s: %s at position %d", name.Text, common.ErrConstructArguments, name.Pos)
+		}
+		p.pos++
+	}
+	return bound, nil
+}
+
+// isBound reports whether name is a variable bound by an enclosing construct.
+func (p *Parser) isBound(name string) bool {
+	for _, variable := range p.scope {
+		if variable == name {
+			return true
+		}
 	}
+	return false
 }
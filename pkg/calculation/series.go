@@ -0,0 +1,275 @@
+// Package calculation provides constructs with a bound variable: sum, prod and integrate.
+package calculation
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/flexer2006/y.lms-sprint2-calculator/common"
+)
+
+// Parameters of the adaptive Simpson integration.
+const (
+	integrationTolerance = 1e-10 // Absolute error allowed for the whole interval.
+	integrationDepth     = 20    // Maximum number of interval halvings.
+)
+
+// Series is a sum or a product whose terms can be computed independently,
+// as returned by SplitSeries.
+type Series struct {
+	Op    string     // "+" for sum, "*" for prod.
+	Terms [][]string // Terms in reverse Polish notation, with the variable substituted.
+}
+
+// SplitSeries splits an expression whose outermost operation is a sum or a
+// product with a bound variable, such as sum(i, 1, 100, i^2), into terms, one
+// for each value of the variable. Terms are written in reverse Polish notation
+// using numbers and the binary operators + - * / % ^; any other part of a term,
+// such as a function call or a factorial, is computed in advance. The number of terms is
+// bounded by MaxElements. ok is false when the expression is valid but is not
+// a sum or a product with a bound variable.
+func SplitSeries(ctx context.Context, expression string, limits Limits) (series Series, ok bool, err error) {
+	root, err := parseExpression(ctx, expression, limits)
+	if err != nil {
+		return Series{}, false, err
+	}
+
+	e := &evaluator{ctx: ctx, limits: limits}
+	if root.kind != boundNode || root.token.Text == "integrate" {
+		_, err := e.eval(root)
+		return Series{}, false, err
+	}
+
+	lower, err := e.eval(root.args[0])
+	if err != nil {
+		return Series{}, false, err
+	}
+	upper, err := e.eval(root.args[1])
+	if err != nil {
+		return Series{}, false, err
+	}
+
+	series.Op = "+"
+	if root.token.Text == "prod" {
+		series.Op = "*"
+	}
+	err = e.iterate(root, lower, upper, func(float64) error {
+		term, err := e.rpn(root.args[2])
+		if err != nil {
+			return err
+		}
+		series.Terms = append(series.Terms, term)
+		return nil
+	})
+	if err != nil {
+		return Series{}, false, err
+	}
+	return series, true, nil
+}
+
+// bound computes a construct with a bound variable between the given bounds.
+func (e *evaluator) bound(n *node, lower, upper Value) (Value, error) {
+	if n.token.Text == "integrate" {
+		if lower.Kind != ScalarValue || upper.Kind != ScalarValue {
+			return Value{}, fmt.Errorf("%s: %s at position %d", n.token.Text, common.ErrBoundsNotScalar, n.token.Pos)
+		}
+		if !isFinite(lower.Scalar) || !isFinite(upper.Scalar) {
+			return Value{}, fmt.Errorf("%s: %w at position %d", n.token.Text, ErrBoundsNotFinite, n.token.Pos)
+		}
+		integral, err := e.integrate(n, lower.Scalar, upper.Scalar)
+		return Scalar(integral), err
+	}
+
+	result := 0.0
+	if n.token.Text == "prod" {
+		result = 1
+	}
+	err := e.iterate(n, lower, upper, func(x float64) error {
+		term, err := e.at(n, x)
+		if err != nil {
+			return err
+		}
+		if n.token.Text == "prod" {
+			result *= term
+		} else {
+			result += term
+		}
+		return e.limits.checkMagnitude(result)
+	})
+	return Scalar(result), err
+}
+
+// iterate calls step for each value of the variable of n from lower to upper
+// in steps of one, with the variable bound to that value. Nothing is called
+// when upper is less than lower.
+func (e *evaluator) iterate(n *node, lower, upper Value, step func(x float64) error) error {
+	if lower.Kind != ScalarValue || upper.Kind != ScalarValue {
+		return fmt.Errorf("%s: %s at position %d", n.token.Text, common.ErrBoundsNotScalar, n.token.Pos)
+	}
+
+	from, to := lower.Scalar, upper.Scalar
+	if !isFinite(from) || !isFinite(to) {
+		return fmt.Errorf("%s: %w at position %d", n.token.Text, ErrBoundsNotFinite, n.token.Pos)
+	}
+	count := 0.0
+	if to >= from {
+		count = math.Floor(to-from) + 1
+	}
+	if err := e.limits.checkElements(count); err != nil {
+		return err
+	}
+
+	for i := 0.0; i < count; i++ {
+		if err := e.ctx.Err(); err != nil {
+			return &CanceledError{Err: err}
+		}
+		restore := e.bind(n.variable, from+i)
+		err := step(from + i)
+		restore()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// at evaluates the body of n with its variable bound to x.
+func (e *evaluator) at(n *node, x float64) (float64, error) {
+	restore := e.bind(n.variable, x)
+	defer restore()
+
+	value, err := e.eval(n.args[2])
+	if err != nil {
+		return 0, err
+	}
+	if value.Kind != ScalarValue {
+		return 0, fmt.Errorf("%s: %s at position %d", n.token.Text, common.ErrBodyNotScalar, n.token.Pos)
+	}
+	return value.Scalar, nil
+}
+
+// bind sets variable to x and returns a function restoring its previous binding.
+func (e *evaluator) bind(variable string, x float64) (restore func()) {
+	if e.vars == nil {
+		e.vars = make(map[string]float64)
+	}
+	previous, shadowed := e.vars[variable]
+	e.vars[variable] = x
+	return func() {
+		if shadowed {
+			e.vars[variable] = previous
+		} else {
+			delete(e.vars, variable)
+		}
+	}
+}
+
+// integrate computes the definite integral of the body of n from a to b by
+// adaptive Simpson's rule. Every evaluation of the body counts as an element
+// against MaxElements.
+func (e *evaluator) integrate(n *node, a, b float64) (float64, error) {
+	evaluations := 0
+	f := func(x float64) (float64, error) {
+		evaluations++
+		if err := e.limits.checkElements(float64(evaluations)); err != nil {
+			return 0, err
+		}
+		return e.at(n, x)
+	}
+
+	m := (a + b) / 2
+	fa, err := f(a)
+	if err != nil {
+		return 0, err
+	}
+	fm, err := f(m)
+	if err != nil {
+		return 0, err
+	}
+	fb, err := f(b)
+	if err != nil {
+		return 0, err
+	}
+
+	whole := (b - a) / 6 * (fa + 4*fm + fb)
+	integral, err := adaptiveSimpson(f, a, b, fa, fm, fb, whole, integrationTolerance, integrationDepth)
+	if err != nil {
+		return 0, err
+	}
+	return integral, e.limits.checkMagnitude(integral)
+}
+
+// adaptiveSimpson refines the Simpson estimate whole of the integral of f over
+// [a, b], halving the interval until the estimate changes by less than eps.
+func adaptiveSimpson(f func(float64) (float64, error), a, b, fa, fm, fb, whole, eps float64, depth int) (float64, error) {
+	m := (a + b) / 2
+	lm, rm := (a+m)/2, (m+b)/2
+	flm, err := f(lm)
+	if err != nil {
+		return 0, err
+	}
+	frm, err := f(rm)
+	if err != nil {
+		return 0, err
+	}
+
+	left := (m - a) / 6 * (fa + 4*flm + fm)
+	right := (b - m) / 6 * (fm + 4*frm + fb)
+	delta := left + right - whole
+	if depth <= 0 || math.Abs(delta) <= 15*eps {
+		return left + right + delta/15, nil
+	}
+
+	leftIntegral, err := adaptiveSimpson(f, a, m, fa, flm, fm, left, eps/2, depth-1)
+	if err != nil {
+		return 0, err
+	}
+	rightIntegral, err := adaptiveSimpson(f, m, b, fm, frm, fb, right, eps/2, depth-1)
+	if err != nil {
+		return 0, err
+	}
+	return leftIntegral + rightIntegral, nil
+}
+
+// rpn writes the term n in reverse Polish notation with the current variable
+// bindings substituted. Arithmetic on numbers and variables is kept; every
+// other subexpression is computed and must be a number.
+func (e *evaluator) rpn(n *node) ([]string, error) {
+	switch {
+	case n.kind == variableNode:
+		return []string{formatNumber(e.vars[n.token.Text])}, nil
+	case n.kind == valueNode && n.value.Kind == ScalarValue:
+		return []string{formatNumber(n.value.Scalar)}, nil
+	case n.kind == unaryNode:
+		operand, err := e.rpn(n.args[0])
+		if err != nil {
+			return nil, err
+		}
+		if len(operand) == 1 {
+			x, _ := strconv.ParseFloat(operand[0], 64)
+			return []string{formatNumber(-x)}, nil
+		}
+		return append(operand, "-1", "*"), nil
+	case n.kind == binaryNode:
+		left, err := e.rpn(n.args[0])
+		if err != nil {
+			return nil, err
+		}
+		right, err := e.rpn(n.args[1])
+		if err != nil {
+			return nil, err
+		}
+		return append(append(left, right...), n.token.Text), nil
+	}
+
+	value, err := e.eval(n)
+	if err != nil {
+		return nil, err
+	}
+	if value.Kind != ScalarValue {
+		return nil, fmt.Errorf("%s at position %d", common.ErrBodyNotScalar, n.token.Pos)
+	}
+	return []string{formatNumber(value.Scalar)}, nil
+}
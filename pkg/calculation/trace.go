@@ -0,0 +1,73 @@
+// Package calculation provides step-by-step evaluation traces.
+package calculation
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/flexer2006/y.lms-sprint2-calculator/common"
+)
+
+// EvaluateWithTrace evaluates expression one reduction at a time and returns
+// every intermediate form, from the parsed expression to the result, e.g.
+// "(2+3)*4", "5*4", "20". Operations are reduced innermost first, left to right,
+// and each step is printed with the minimum number of parentheses. If a
+// reduction fails, the steps up to it are returned together with the error.
+func EvaluateWithTrace(expression string) ([]string, error) {
+	root, err := parseExpression(context.Background(), expression, Limits{})
+	if err != nil {
+		return nil, err
+	}
+
+	e := &evaluator{ctx: context.Background()}
+	steps := []string{root.String()}
+	for redex := root.redex(); redex != nil; redex = root.redex() {
+		args := make([]Value, len(redex.args))
+		for i, arg := range redex.args {
+			args[i] = arg.value
+		}
+
+		value, err := e.reduce(redex, args)
+		if err != nil {
+			return steps, err
+		}
+		redex.reduceTo(value)
+
+		// Reductions that do not change the text, such as negating a literal, are not steps.
+		if step := root.String(); step != steps[len(steps)-1] {
+			steps = append(steps, step)
+		}
+	}
+	return steps, nil
+}
+
+// FormatRPN prints expressions written in reverse Polish notation, such as
+// "2 3 + 4 *", in infix form with the minimum number of parentheses: "(2+3)*4".
+// Tokens are numbers and the binary operators + - * / % ^. Several complete
+// expressions may follow each other; one string is returned for each.
+func FormatRPN(tokens []string) ([]string, error) {
+	var stack []*node
+	for _, text := range tokens {
+		switch text {
+		case "+", "-", "*", "/", "%", "^":
+			if len(stack) < 2 {
+				return nil, fmt.Errorf("%s for %q", common.ErrMissingOperand, text)
+			}
+			args := []*node{stack[len(stack)-2], stack[len(stack)-1]}
+			stack = append(stack[:len(stack)-2], &node{kind: binaryNode, token: Token{Kind: TokenOperator, Text: text}, args: args})
+		default:
+			num, err := strconv.ParseFloat(text, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s %q", common.ErrUnexpectedToken, text)
+			}
+			stack = append(stack, &node{kind: valueNode, token: Token{Kind: TokenNumber, Text: text}, value: Scalar(num)})
+		}
+	}
+
+	expressions := make([]string, len(stack))
+	for i, n := range stack {
+		expressions[i] = n.String()
+	}
+	return expressions, nil
+}
@@ -0,0 +1,232 @@
+// Package calculation provides the values produced by expression evaluation.
+package calculation
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/flexer2006/y.lms-sprint2-calculator/common"
+)
+
+// ValueKind classifies an evaluation result.
+type ValueKind int
+
+const (
+	// ScalarValue is a single number.
+	ScalarValue ValueKind = iota
+	// ListValue is an ordered list of numbers. In matrix products it acts as a vector.
+	ListValue
+	// MatrixValue is a rectangular matrix of numbers.
+	MatrixValue
+)
+
+// Value is the result of evaluating an expression or subexpression.
+type Value struct {
+	Kind   ValueKind   // Kind of the value.
+	Scalar float64     // Number, for ScalarValue.
+	List   []float64   // Elements, for ListValue.
+	Matrix [][]float64 // Rows of equal length, for MatrixValue.
+}
+
+// Scalar returns a scalar value.
+func Scalar(x float64) Value {
+	return Value{Kind: ScalarValue, Scalar: x}
+}
+
+// List returns a list value holding elements.
+func List(elements []float64) Value {
+	return Value{Kind: ListValue, List: elements}
+}
+
+// Matrix returns a matrix value holding rows. All rows must have the same length.
+func Matrix(rows [][]float64) Value {
+	return Value{Kind: MatrixValue, Matrix: rows}
+}
+
+// String formats the value as it would be written in an expression.
+func (v Value) String() string {
+	switch v.Kind {
+	case ListValue:
+		return formatList(v.List)
+	case MatrixValue:
+		rows := make([]string, len(v.Matrix))
+		for i, row := range v.Matrix {
+			rows[i] = formatList(row)
+		}
+		return "[" + strings.Join(rows, ", ") + "]"
+	default:
+		return formatNumber(v.Scalar)
+	}
+}
+
+// shape describes the dimensions of the value for error messages:
+// "scalar", the length of a list, or rows x columns of a matrix.
+func (v Value) shape() string {
+	switch v.Kind {
+	case ListValue:
+		return strconv.Itoa(len(v.List))
+	case MatrixValue:
+		if len(v.Matrix) == 0 {
+			return "0x0"
+		}
+		return fmt.Sprintf("%dx%d", len(v.Matrix), len(v.Matrix[0]))
+	default:
+		return "scalar"
+	}
+}
+
+// elements returns every number held by the value, matrices row by row.
+func (v Value) elements() []float64 {
+	switch v.Kind {
+	case ListValue:
+		return v.List
+	case MatrixValue:
+		var result []float64
+		for _, row := range v.Matrix {
+			result = append(result, row...)
+		}
+		return result
+	default:
+		return []float64{v.Scalar}
+	}
+}
+
+// formatList formats numbers as a list literal.
+func formatList(list []float64) string {
+	parts := make([]string, len(list))
+	for i, x := range list {
+		parts[i] = formatNumber(x)
+	}
+	return "[" + strings.Join(parts, ", ") + "]"
+}
+
+// formatNumber formats a number in its shortest exact form.
+func formatNumber(x float64) string {
+	return strconv.FormatFloat(x, 'g', -1, 64)
+}
+
+// mapValue applies fn to every element of v.
+func mapValue(v Value, fn func(float64) (float64, error)) (Value, error) {
+	switch v.Kind {
+	case ListValue:
+		result, err := mapList(v.List, fn)
+		if err != nil {
+			return Value{}, err
+		}
+		return List(result), nil
+	case MatrixValue:
+		rows := make([][]float64, len(v.Matrix))
+		for i, row := range v.Matrix {
+			result, err := mapList(row, fn)
+			if err != nil {
+				return Value{}, err
+			}
+			rows[i] = result
+		}
+		return Matrix(rows), nil
+	default:
+		x, err := fn(v.Scalar)
+		if err != nil {
+			return Value{}, err
+		}
+		return Scalar(x), nil
+	}
+}
+
+// mapList applies fn to every element of list.
+func mapList(list []float64, fn func(float64) (float64, error)) ([]float64, error) {
+	result := make([]float64, len(list))
+	for i, x := range list {
+		y, err := fn(x)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = y
+	}
+	return result, nil
+}
+
+// binaryValue applies fn element-wise to a and b. A scalar operand is
+// broadcast over the other operand; otherwise both operands must have the
+// same kind and shape, or a *DimensionError is returned.
+func binaryValue(a, b Value, fn func(x, y float64) (float64, error)) (Value, error) {
+	switch {
+	case a.Kind == ScalarValue && b.Kind == ScalarValue:
+		x, err := fn(a.Scalar, b.Scalar)
+		if err != nil {
+			return Value{}, err
+		}
+		return Scalar(x), nil
+	case a.Kind == ScalarValue:
+		return mapValue(b, func(y float64) (float64, error) { return fn(a.Scalar, y) })
+	case b.Kind == ScalarValue:
+		return mapValue(a, func(x float64) (float64, error) { return fn(x, b.Scalar) })
+	}
+
+	if a.Kind != b.Kind || a.shape() != b.shape() {
+		return Value{}, &DimensionError{Left: a.shape(), Right: b.shape()}
+	}
+
+	if a.Kind == ListValue {
+		result, err := zipList(a.List, b.List, fn)
+		if err != nil {
+			return Value{}, err
+		}
+		return List(result), nil
+	}
+
+	rows := make([][]float64, len(a.Matrix))
+	for i := range a.Matrix {
+		result, err := zipList(a.Matrix[i], b.Matrix[i], fn)
+		if err != nil {
+			return Value{}, err
+		}
+		rows[i] = result
+	}
+	return Matrix(rows), nil
+}
+
+// zipList applies fn to pairs of elements of two lists of the same length.
+func zipList(a, b []float64, fn func(x, y float64) (float64, error)) ([]float64, error) {
+	result := make([]float64, len(a))
+	for i := range a {
+		x, err := fn(a[i], b[i])
+		if err != nil {
+			return nil, err
+		}
+		result[i] = x
+	}
+	return result, nil
+}
+
+// applyOperator computes x op y for a binary arithmetic operator.
+func applyOperator(op string, x, y float64) (float64, error) {
+	switch op {
+	case "+":
+		return x + y, nil
+	case "-":
+		return x - y, nil
+	case "*":
+		return x * y, nil
+	case "/":
+		if y == 0 {
+			return 0, errors.New(common.ErrDivisionByZero)
+		}
+		return x / y, nil
+	case "%":
+		if y == 0 {
+			return 0, errors.New(common.ErrModuloByZero)
+		}
+		if x != math.Trunc(x) || y != math.Trunc(y) {
+			return 0, errors.New(common.ErrInvalidModulo)
+		}
+		return math.Mod(x, y), nil
+	case "^":
+		return math.Pow(x, y), nil
+	default:
+		return 0, fmt.Errorf("%s: %s", common.ErrUnexpectedToken, op)
+	}
+}
@@ -1,6 +1,10 @@
 package test
 
 import (
+	"context"
+	"errors"
+	"math"
+	"strings"
 	"testing"
 
 	"github.com/flexer2006/y.lms-sprint2-calculator/pkg/calculation"
@@ -238,6 +242,494 @@ func TestCalculator(t *testing.T) {
 			expr:     "((((1 + 2) * 3) - 4) / 5) * (-2)",
 			expected: -2,
 		},
+		{
+			name:     "factorial",
+			expr:     "5!",
+			expected: 120,
+		},
+		{
+			name:     "factorial of zero",
+			expr:     "0!",
+			expected: 1,
+		},
+		{
+			name:     "factorial of non-integer uses gamma",
+			expr:     "0.5!",
+			expected: 0.886226925452758,
+		},
+		{
+			name:     "factorial binds tighter than multiplication",
+			expr:     "2 * 3!",
+			expected: 12,
+		},
+		{
+			name:     "factorial in exponent",
+			expr:     "2^3!",
+			expected: 64,
+		},
+		{
+			name:     "factorial before power",
+			expr:     "3!^2",
+			expected: 36,
+		},
+		{
+			name:     "unary minus applies after factorial",
+			expr:     "-3!",
+			expected: -6,
+		},
+		{
+			name:     "double factorial applications",
+			expr:     "3!!",
+			expected: 720,
+		},
+		{
+			name:    "factorial of negative integer",
+			expr:    "(-3)!",
+			wantErr: true,
+		},
+		{
+			name:     "unary minus applies after power",
+			expr:     "-2^2",
+			expected: -4,
+		},
+		{
+			name:     "negative exponent",
+			expr:     "2^-2",
+			expected: 0.25,
+		},
+		{
+			name:     "power is right associative",
+			expr:     "2^3^2",
+			expected: 512,
+		},
+		{
+			name:     "absolute value",
+			expr:     "|-3| + 1",
+			expected: 4,
+		},
+		{
+			name:     "absolute value of expression",
+			expr:     "|2 - 5| * 2",
+			expected: 6,
+		},
+		{
+			name:     "nested absolute values",
+			expr:     "||-2| - 5|",
+			expected: 3,
+		},
+		{
+			name:     "factorial of absolute value",
+			expr:     "|-4|!",
+			expected: 24,
+		},
+		{
+			name:    "unclosed absolute value",
+			expr:    "|2 - 5",
+			wantErr: true,
+		},
+		{
+			name:     "postfix square",
+			expr:     "3²",
+			expected: 9,
+		},
+		{
+			name:     "postfix cube",
+			expr:     "2³ + 1",
+			expected: 9,
+		},
+		{
+			name:     "unary minus applies after postfix square",
+			expr:     "-3²",
+			expected: -9,
+		},
+		{
+			name:     "postfix square of parentheses",
+			expr:     "(1 + 2)²",
+			expected: 9,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := calculation.EvaluateExpression(tt.expr)
+
+			if tt.wantErr {
+				assert.Error(t, err, "Expected error for expression: %s", tt.expr)
+				return
+			}
+
+			require.NoError(t, err, "Unexpected error for expression: %s", tt.expr)
+			assert.InDelta(t, tt.expected, result, 1e-10, "Unexpected result for expression: %s", tt.expr)
+		})
+	}
+}
+
+func TestEvaluateContext_Limits(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		expr     string
+		limits   calculation.Limits
+		expected float64
+		wantErr  error
+	}{
+		{
+			name:     "within all limits",
+			expr:     "(1 + 2) * 3",
+			limits:   calculation.Limits{MaxDepth: 5, MaxTokens: 10, MaxLength: 20, MaxMagnitude: 100},
+			expected: 9,
+		},
+		{
+			name:    "length limit",
+			expr:    "1 + 2 + 3",
+			limits:  calculation.Limits{MaxLength: 5},
+			wantErr: calculation.ErrMaxLengthExceeded,
+		},
+		{
+			name:    "token limit",
+			expr:    "1+2+3+4",
+			limits:  calculation.Limits{MaxTokens: 5},
+			wantErr: calculation.ErrMaxTokensExceeded,
+		},
+		{
+			name:    "depth limit on nested parentheses",
+			expr:    strings.Repeat("(", 50) + "1" + strings.Repeat(")", 50),
+			limits:  calculation.Limits{MaxDepth: 10},
+			wantErr: calculation.ErrMaxDepthExceeded,
+		},
+		{
+			name:    "depth limit on exponent chains",
+			expr:    "2^2^2^2^2^2",
+			limits:  calculation.Limits{MaxDepth: 3},
+			wantErr: calculation.ErrMaxDepthExceeded,
+		},
+		{
+			name:    "magnitude limit on power tower",
+			expr:    "9^9^9^9",
+			limits:  calculation.Limits{MaxMagnitude: 1e300},
+			wantErr: calculation.ErrMaxMagnitudeExceeded,
+		},
+		{
+			name:    "magnitude limit on literal",
+			expr:    "1000 + 1",
+			limits:  calculation.Limits{MaxMagnitude: 100},
+			wantErr: calculation.ErrMaxMagnitudeExceeded,
+		},
+		{
+			name:    "magnitude limit on factorial",
+			expr:    "20!",
+			limits:  calculation.Limits{MaxMagnitude: 1e12},
+			wantErr: calculation.ErrMaxMagnitudeExceeded,
+		},
+		{
+			name:     "zero limits are unlimited",
+			expr:     strings.Repeat("(", 200) + "1" + strings.Repeat(")", 200),
+			expected: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := calculation.EvaluateContext(context.Background(), tt.expr, tt.limits)
+
+			if tt.wantErr != nil {
+				require.Error(t, err)
+				assert.ErrorIs(t, err, tt.wantErr)
+
+				var limitErr *calculation.LimitError
+				assert.True(t, errors.As(err, &limitErr), "Expected *LimitError, got %T", err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.InDelta(t, tt.expected, result, 1e-10)
+		})
+	}
+}
+
+func TestEvaluateContext_Canceled(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := calculation.EvaluateContext(ctx, "1 + 2", calculation.Limits{})
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	var canceledErr *calculation.CanceledError
+	assert.True(t, errors.As(err, &canceledErr), "Expected *CanceledError, got %T", err)
+}
+
+func TestFormat(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		value    float64
+		opts     calculation.FormatOptions
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:     "floating point noise",
+			value:    0.1 + 0.2,
+			opts:     calculation.FormatOptions{Digits: 2},
+			expected: "0.30",
+		},
+		{
+			name:     "half-even rounds tie to even",
+			value:    2.125,
+			opts:     calculation.FormatOptions{Digits: 2, Rounding: calculation.RoundHalfEven},
+			expected: "2.12",
+		},
+		{
+			name:     "half-even rounds tie up to even",
+			value:    2.135,
+			opts:     calculation.FormatOptions{Digits: 2, Rounding: calculation.RoundHalfEven},
+			expected: "2.14",
+		},
+		{
+			name:     "half-up uses shortest decimal representation",
+			value:    2.675,
+			opts:     calculation.FormatOptions{Digits: 2, Rounding: calculation.RoundHalfUp},
+			expected: "2.68",
+		},
+		{
+			name:     "half-up on negative rounds away from zero",
+			value:    -2.5,
+			opts:     calculation.FormatOptions{Digits: 0, Rounding: calculation.RoundHalfUp},
+			expected: "-3",
+		},
+		{
+			name:     "down truncates",
+			value:    -2.999,
+			opts:     calculation.FormatOptions{Digits: 2, Rounding: calculation.RoundDown},
+			expected: "-2.99",
+		},
+		{
+			name:     "rounding carries into integer part",
+			value:    9.996,
+			opts:     calculation.FormatOptions{Digits: 2},
+			expected: "10.00",
+		},
+		{
+			name:     "small value rounds up to last digit",
+			value:    0.006,
+			opts:     calculation.FormatOptions{Digits: 2},
+			expected: "0.01",
+		},
+		{
+			name:     "negative zero after rounding has no sign",
+			value:    -0.001,
+			opts:     calculation.FormatOptions{Digits: 2},
+			expected: "0.00",
+		},
+		{
+			name:     "plain pads large integers",
+			value:    1234567,
+			opts:     calculation.FormatOptions{Digits: 1},
+			expected: "1234567.0",
+		},
+		{
+			name:     "scientific",
+			value:    123456,
+			opts:     calculation.FormatOptions{Digits: 2, Notation: calculation.NotationScientific},
+			expected: "1.23e+5",
+		},
+		{
+			name:     "scientific with negative exponent",
+			value:    0.000123,
+			opts:     calculation.FormatOptions{Digits: 1, Notation: calculation.NotationScientific},
+			expected: "1.2e-4",
+		},
+		{
+			name:     "scientific carry bumps exponent",
+			value:    9.99,
+			opts:     calculation.FormatOptions{Digits: 1, Notation: calculation.NotationScientific},
+			expected: "1.0e+1",
+		},
+		{
+			name:     "engineering",
+			value:    123456,
+			opts:     calculation.FormatOptions{Digits: 1, Notation: calculation.NotationEngineering},
+			expected: "123.5e+3",
+		},
+		{
+			name:     "engineering with negative exponent",
+			value:    0.0012,
+			opts:     calculation.FormatOptions{Digits: 0, Notation: calculation.NotationEngineering},
+			expected: "1e-3",
+		},
+		{
+			name:     "engineering carry moves to next group",
+			value:    999.96,
+			opts:     calculation.FormatOptions{Digits: 1, Notation: calculation.NotationEngineering},
+			expected: "1.0e+3",
+		},
+		{
+			name:     "zero in scientific notation",
+			value:    0,
+			opts:     calculation.FormatOptions{Digits: 2, Notation: calculation.NotationScientific},
+			expected: "0.00e+0",
+		},
+		{
+			name:    "invalid rounding mode",
+			value:   1,
+			opts:    calculation.FormatOptions{Rounding: "ceiling"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid notation",
+			value:   1,
+			opts:    calculation.FormatOptions{Notation: "roman"},
+			wantErr: true,
+		},
+		{
+			name:    "negative digits",
+			value:   1,
+			opts:    calculation.FormatOptions{Digits: -1},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := calculation.Format(tt.value, tt.opts)
+
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestEvaluateValue_Lists(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		expr     string
+		expected calculation.Value
+		wantErr  bool
+	}{
+		{
+			name:     "list literal",
+			expr:     "[1, 2, 3]",
+			expected: calculation.List([]float64{1, 2, 3}),
+		},
+		{
+			name:     "empty list",
+			expr:     "[]",
+			expected: calculation.List([]float64{}),
+		},
+		{
+			name:     "range",
+			expr:     "1..5",
+			expected: calculation.List([]float64{1, 2, 3, 4, 5}),
+		},
+		{
+			name:     "descending range",
+			expr:     "3..1",
+			expected: calculation.List([]float64{3, 2, 1}),
+		},
+		{
+			name:     "range spliced into list",
+			expr:     "[0, 2..4, 10]",
+			expected: calculation.List([]float64{0, 2, 3, 4, 10}),
+		},
+		{
+			name:     "element-wise addition",
+			expr:     "[1, 2, 3] + [10, 20, 30]",
+			expected: calculation.List([]float64{11, 22, 33}),
+		},
+		{
+			name:     "scalar broadcast",
+			expr:     "2 * [1, 2, 3] - 1",
+			expected: calculation.List([]float64{1, 3, 5}),
+		},
+		{
+			name:     "element-wise postfix and unary minus",
+			expr:     "-[1, 2, 3]²",
+			expected: calculation.List([]float64{-1, -4, -9}),
+		},
+		{
+			name:     "range bounds are expressions",
+			expr:     "(1 + 1)..(2 * 2)",
+			expected: calculation.List([]float64{2, 3, 4}),
+		},
+		{
+			name:    "length mismatch",
+			expr:    "[1, 2] + [1, 2, 3]",
+			wantErr: true,
+		},
+		{
+			name:    "list nested deeper than a matrix",
+			expr:    "[[[1, 2]], [[3, 4]]]",
+			wantErr: true,
+		},
+		{
+			name:    "unclosed list",
+			expr:    "[1, 2",
+			wantErr: true,
+		},
+		{
+			name:    "trailing comma",
+			expr:    "[1, 2,]",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := calculation.EvaluateValue(context.Background(), tt.expr, calculation.Limits{})
+
+			if tt.wantErr {
+				assert.Error(t, err, "Expected error for expression: %s", tt.expr)
+				return
+			}
+
+			require.NoError(t, err, "Unexpected error for expression: %s", tt.expr)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestEvaluateExpression_Aggregates(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		expr     string
+		expected float64
+		wantErr  bool
+	}{
+		{name: "sum of range", expr: "sum(1..100)", expected: 5050},
+		{name: "sum of arguments", expr: "sum(1, 2, 3)", expected: 6},
+		{name: "sum of empty list", expr: "sum([])", expected: 0},
+		{name: "avg", expr: "avg([2, 4, 9])", expected: 5},
+		{name: "median odd", expr: "median([5, 1, 3])", expected: 3},
+		{name: "median even", expr: "median([4, 1, 3, 2])", expected: 2.5},
+		{name: "stdev", expr: "stdev([2, 4, 4, 4, 5, 5, 7, 9])", expected: 2.138089935299395},
+		{name: "min", expr: "min([3, -1, 2])", expected: -1},
+		{name: "max flattens arguments", expr: "max([3, 1], 7, 2..4)", expected: 7},
+		{name: "count", expr: "count(1..10)", expected: 10},
+		{name: "aggregate in arithmetic", expr: "sum([1, 2, 3]) * 2 + count([])", expected: 12},
+		{name: "aggregate of element-wise result", expr: "sum([1, 2, 3]²)", expected: 14},
+		{name: "avg of empty list", expr: "avg([])", wantErr: true},
+		{name: "stdev of single value", expr: "stdev([1])", wantErr: true},
+		{name: "unknown function", expr: "foo(1)", wantErr: true},
+		{name: "function without call", expr: "sum + 1", wantErr: true},
+		{name: "list result is not a number", expr: "[1, 2]", wantErr: true},
 	}
 
 	for _, tt := range tests {
@@ -255,3 +747,562 @@ func TestCalculator(t *testing.T) {
 		})
 	}
 }
+
+func TestEvaluateContext_ElementLimit(t *testing.T) {
+	t.Parallel()
+
+	_, err := calculation.EvaluateContext(context.Background(), "sum(1..1000000000)", calculation.Limits{MaxElements: 1000})
+	require.Error(t, err)
+	assert.ErrorIs(t, err, calculation.ErrMaxElementsExceeded)
+}
+
+func TestEvaluateExpression_HugeRange(t *testing.T) {
+	t.Parallel()
+
+	for _, expr := range []string{
+		"sum(1..100000000000000000000)",
+		"sum(100000000000000000000..1)",
+		"sum(1..1000000000)",
+	} {
+		var err error
+		require.NotPanics(t, func() { _, err = calculation.EvaluateExpression(expr) }, "expression: %s", expr)
+		assert.ErrorIs(t, err, calculation.ErrMaxElementsExceeded, "expression: %s", expr)
+	}
+}
+
+func TestEvaluateExpression_NonFiniteRange(t *testing.T) {
+	t.Parallel()
+
+	for _, expr := range []string{
+		"((-1)^0.5)..3",
+		"sum([((-1)^0.5)..3])",
+		"sum(i, (-1)^0.5, 3, i)",
+		"integrate(x, 0, (-1)^0.5, x)",
+	} {
+		var err error
+		require.NotPanics(t, func() { _, err = calculation.EvaluateValue(context.Background(), expr, calculation.Limits{}) }, "expression: %s", expr)
+		assert.ErrorIs(t, err, calculation.ErrBoundsNotFinite, "expression: %s", expr)
+	}
+}
+
+func TestEvaluateValue_Matrices(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		expr     string
+		expected calculation.Value
+		wantErr  bool
+	}{
+		{
+			name:     "matrix literal",
+			expr:     "[[1, 2], [3, 4]]",
+			expected: calculation.Matrix([][]float64{{1, 2}, {3, 4}}),
+		},
+		{
+			name:     "rows from ranges",
+			expr:     "[[1..3], [4..6]]",
+			expected: calculation.Matrix([][]float64{{1, 2, 3}, {4, 5, 6}}),
+		},
+		{
+			name:     "addition and subtraction",
+			expr:     "[[1, 2], [3, 4]] + [[10, 20], [30, 40]] - [[1, 1], [1, 1]]",
+			expected: calculation.Matrix([][]float64{{10, 21}, {32, 43}}),
+		},
+		{
+			name:     "scalar multiplication",
+			expr:     "2 * [[1, 2], [3, 4]] / 4",
+			expected: calculation.Matrix([][]float64{{0.5, 1}, {1.5, 2}}),
+		},
+		{
+			name:     "matrix product",
+			expr:     "[[1, 2], [3, 4]] * [[5, 6], [7, 8]]",
+			expected: calculation.Matrix([][]float64{{19, 22}, {43, 50}}),
+		},
+		{
+			name:     "non-square product",
+			expr:     "[[1, 2, 3]] * [[1], [2], [3]]",
+			expected: calculation.Matrix([][]float64{{14}}),
+		},
+		{
+			name:     "matrix times vector",
+			expr:     "[[1, 2], [3, 4]] * [1, 1]",
+			expected: calculation.List([]float64{3, 7}),
+		},
+		{
+			name:     "vector times matrix",
+			expr:     "[1, 1] * [[1, 2], [3, 4]]",
+			expected: calculation.List([]float64{4, 6}),
+		},
+		{
+			name:     "unary minus and abs",
+			expr:     "|-[[1, -2], [3, -4]]|",
+			expected: calculation.Matrix([][]float64{{1, 2}, {3, 4}}),
+		},
+		{
+			name:     "transpose",
+			expr:     "transpose([[1, 2, 3], [4, 5, 6]])",
+			expected: calculation.Matrix([][]float64{{1, 4}, {2, 5}, {3, 6}}),
+		},
+		{
+			name:     "transpose of a list is a column",
+			expr:     "transpose([1, 2])",
+			expected: calculation.Matrix([][]float64{{1}, {2}}),
+		},
+		{
+			name:     "inverse",
+			expr:     "inv([[4, 7], [2, 6]])",
+			expected: calculation.Matrix([][]float64{{0.6, -0.7}, {-0.2, 0.4}}),
+		},
+		{
+			name:     "solve",
+			expr:     "solve([[2, 1], [1, 3]], [3, 5])",
+			expected: calculation.List([]float64{0.8, 1.4}),
+		},
+		{
+			name:     "solve for several right-hand sides",
+			expr:     "solve([[2, 0], [0, 4]], [[2, 4], [4, 8]])",
+			expected: calculation.Matrix([][]float64{{1, 2}, {1, 2}}),
+		},
+		{
+			name:     "product with inverse is identity",
+			expr:     "[[2, 1], [1, 1]] * inv([[2, 1], [1, 1]])",
+			expected: calculation.Matrix([][]float64{{1, 0}, {0, 1}}),
+		},
+		{name: "ragged rows", expr: "[[1, 2], [3]]", wantErr: true},
+		{name: "empty row", expr: "[[]]", wantErr: true},
+		{name: "scalar mixed with rows", expr: "[[1, 2], 3]", wantErr: true},
+		{name: "nested matrix", expr: "[[[1]]]", wantErr: true},
+		{name: "power of a matrix", expr: "[[1, 2], [3, 4]] ^ 2", wantErr: true},
+		{name: "squared matrix", expr: "[[1, 2], [3, 4]]²", wantErr: true},
+		{name: "division by a matrix", expr: "1 / [[1, 2], [3, 4]]", wantErr: true},
+		{name: "inverse of a singular matrix", expr: "inv([[1, 2], [2, 4]])", wantErr: true},
+		{name: "determinant of a non-square matrix", expr: "det([[1, 2, 3]])", wantErr: true},
+		{name: "solve with wrong right-hand side", expr: "solve([[1, 0], [0, 1]], [1, 2, 3])", wantErr: true},
+		{name: "solve with one argument", expr: "solve([[1, 0], [0, 1]])", wantErr: true},
+		{name: "matrix plus list", expr: "[[1, 2], [3, 4]] + [1, 2]", wantErr: true},
+		{name: "determinant of an empty transpose", expr: "det(transpose([]))", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := calculation.EvaluateValue(context.Background(), tt.expr, calculation.Limits{})
+
+			if tt.wantErr {
+				assert.Error(t, err, "Expected error for expression: %s", tt.expr)
+				return
+			}
+
+			require.NoError(t, err, "Unexpected error for expression: %s", tt.expr)
+			require.Equal(t, tt.expected.Kind, result.Kind)
+			assert.InDeltaSlice(t, tt.expected.List, result.List, 1e-10)
+			require.Len(t, result.Matrix, len(tt.expected.Matrix))
+			for i := range tt.expected.Matrix {
+				assert.InDeltaSlice(t, tt.expected.Matrix[i], result.Matrix[i], 1e-10)
+			}
+		})
+	}
+}
+
+func TestEvaluateExpression_Determinant(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		expr     string
+		expected float64
+	}{
+		{expr: "det([[1, 2], [3, 4]])", expected: -2},
+		{expr: "det([[2, 0, 1], [1, 3, 2], [1, 1, 2]])", expected: 6},
+		{expr: "det([[1, 2], [2, 4]])", expected: 0},
+		{expr: "det([[0, 1], [1, 0]])", expected: -1},
+		{expr: "sum([[1, 2], [3, 4]])", expected: 10},
+	}
+
+	for _, tt := range tests {
+		result, err := calculation.EvaluateExpression(tt.expr)
+		require.NoError(t, err, "Unexpected error for expression: %s", tt.expr)
+		assert.InDelta(t, tt.expected, result, 1e-10, "Unexpected result for expression: %s", tt.expr)
+	}
+}
+
+func TestEvaluateValue_DimensionError(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		expr    string
+		wantOp  string
+		wantPos int
+		wantMsg string
+	}{
+		{
+			name:    "product",
+			expr:    "[[1, 2, 3], [4, 5, 6]] * [[1, 2], [3, 4]]",
+			wantOp:  "*",
+			wantPos: 23,
+			wantMsg: `dimension mismatch for "*" at position 23: 2x3 and 2x2`,
+		},
+		{
+			name:    "sum",
+			expr:    "1 + [[1, 2]] + [[1], [2]]",
+			wantOp:  "+",
+			wantPos: 13,
+			wantMsg: `dimension mismatch for "+" at position 13: 1x2 and 2x1`,
+		},
+		{
+			name:    "lists",
+			expr:    "[1, 2] - [1, 2, 3]",
+			wantOp:  "-",
+			wantPos: 7,
+			wantMsg: `dimension mismatch for "-" at position 7: 2 and 3`,
+		},
+		{
+			name:    "function",
+			expr:    "2 * det([[1, 2]])",
+			wantOp:  "det",
+			wantPos: 4,
+			wantMsg: `dimension mismatch for "det" at position 4: 1x2`,
+		},
+		{
+			name:    "transpose of an empty list",
+			expr:    "transpose([]) + [[1]]",
+			wantOp:  "transpose",
+			wantPos: 0,
+			wantMsg: `dimension mismatch for "transpose" at position 0: 0`,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := calculation.EvaluateValue(context.Background(), tt.expr, calculation.Limits{})
+			require.Error(t, err)
+
+			var dimErr *calculation.DimensionError
+			require.True(t, errors.As(err, &dimErr), "Expected DimensionError, got %v", err)
+			assert.Equal(t, tt.wantOp, dimErr.Op)
+			assert.Equal(t, tt.wantPos, dimErr.Pos)
+			assert.Equal(t, tt.wantMsg, err.Error())
+		})
+	}
+}
+
+func TestSplitMatrixProduct(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		expr      string
+		wantOK    bool
+		wantLeft  [][]float64
+		wantRight [][]float64
+	}{
+		{
+			name:      "matrix product",
+			expr:      "[[1, 2], [3, 4]] * [[5, 6], [7, 8]]",
+			wantOK:    true,
+			wantLeft:  [][]float64{{1, 2}, {3, 4}},
+			wantRight: [][]float64{{5, 6}, {7, 8}},
+		},
+		{
+			name:      "operands are evaluated",
+			expr:      "2 * [[1, 2]] * transpose([3, 4])",
+			wantOK:    true,
+			wantLeft:  [][]float64{{2, 4}},
+			wantRight: [][]float64{{3}, {4}},
+		},
+		{
+			name:      "vector on the right is a column",
+			expr:      "[[1, 2], [3, 4]] * [5, 6]",
+			wantOK:    true,
+			wantLeft:  [][]float64{{1, 2}, {3, 4}},
+			wantRight: [][]float64{{5}, {6}},
+		},
+		{name: "sum of products", expr: "[[1]] * [[2]] + [[3]]"},
+		{name: "scaled product", expr: "[[1]] * [[2]] / 2"},
+		{name: "scalar times matrix", expr: "2 * [[1, 2]]"},
+		{name: "lists", expr: "[1, 2] * [3, 4]"},
+		{
+			name:      "product in parentheses",
+			expr:      "([[1]] * [[2]])",
+			wantOK:    true,
+			wantLeft:  [][]float64{{1}},
+			wantRight: [][]float64{{2}},
+		},
+		{name: "product inside a function call", expr: "transpose([[1]] * [[2]])"},
+		{name: "scalar expression", expr: "2 * 3"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			left, right, ok, err := calculation.SplitMatrixProduct(context.Background(), tt.expr, calculation.Limits{})
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.wantLeft, left)
+			assert.Equal(t, tt.wantRight, right)
+		})
+	}
+
+	_, _, _, err := calculation.SplitMatrixProduct(context.Background(), "[[1, 2]] * [[1, 2]]", calculation.Limits{})
+	var dimErr *calculation.DimensionError
+	assert.True(t, errors.As(err, &dimErr))
+}
+
+func TestEvaluateWithTrace(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		expr     string
+		expected []string
+	}{
+		{
+			name:     "parentheses first",
+			expr:     "(2+3)*4",
+			expected: []string{"(2+3)*4", "5*4", "20"},
+		},
+		{
+			name:     "precedence",
+			expr:     "2 + 3 * 4 - 1",
+			expected: []string{"2+3*4-1", "2+12-1", "14-1", "13"},
+		},
+		{
+			name:     "redundant parentheses are dropped",
+			expr:     "((1 + 2)) + (3 * 4)",
+			expected: []string{"1+2+3*4", "3+3*4", "3+12", "15"},
+		},
+		{
+			name:     "right-associative power",
+			expr:     "2^3^2",
+			expected: []string{"2^3^2", "2^9", "512"},
+		},
+		{
+			name:     "negative intermediate result",
+			expr:     "2-(3-4)",
+			expected: []string{"2-(3-4)", "2-(-1)", "3"},
+		},
+		{
+			name:     "negative base keeps parentheses",
+			expr:     "(0-2)^2",
+			expected: []string{"(0-2)^2", "(-2)^2", "4"},
+		},
+		{
+			name:     "unary minus, abs and postfix",
+			expr:     "-|2-5|*3!",
+			expected: []string{"-|2-5|*3!", "-|-3|*3!", "-3*3!", "-3*6", "-18"},
+		},
+		{
+			name:     "ranges and aggregates",
+			expr:     "sum(1..4) / 2",
+			expected: []string{"sum(1..4)/2", "sum([1, 2, 3, 4])/2", "10/2", "5"},
+		},
+		{
+			name:     "range spliced into a list",
+			expr:     "[0, 1..3] * 2",
+			expected: []string{"[0, 1..3]*2", "[0, 1, 2, 3]*2", "[0, 2, 4, 6]"},
+		},
+		{
+			name:     "single number",
+			expr:     "42",
+			expected: []string{"42"},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			steps, err := calculation.EvaluateWithTrace(tt.expr)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, steps)
+		})
+	}
+}
+
+func TestEvaluateWithTrace_Errors(t *testing.T) {
+	t.Parallel()
+
+	steps, err := calculation.EvaluateWithTrace("(1+1) * (3/0)")
+	require.Error(t, err)
+	assert.Equal(t, []string{"(1+1)*(3/0)", "2*(3/0)"}, steps)
+
+	steps, err = calculation.EvaluateWithTrace("2 +")
+	require.Error(t, err)
+	assert.Nil(t, steps)
+}
+
+func TestFormatRPN(t *testing.T) {
+	t.Parallel()
+
+	expressions, err := calculation.FormatRPN([]string{"2", "3", "+", "4", "*"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"(2+3)*4"}, expressions)
+
+	expressions, err = calculation.FormatRPN([]string{"-1", "5", "*", "1", "2", "-", "3", "-", "-", "7"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"-1*5-(1-2-3)", "7"}, expressions)
+
+	_, err = calculation.FormatRPN([]string{"1", "+"})
+	assert.Error(t, err)
+
+	_, err = calculation.FormatRPN([]string{"1", "x", "+"})
+	assert.Error(t, err)
+}
+
+func TestEvaluateExpression_BoundConstructs(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		expr     string
+		expected float64
+		wantErr  bool
+	}{
+		{name: "sum of squares", expr: "sum(i, 1, 100, i^2)", expected: 338350},
+		{name: "factorial as product", expr: "prod(k, 1, 5, k)", expected: 120},
+		{name: "bounds are expressions", expr: "sum(i, 2*1, 1+2, i)", expected: 5},
+		{name: "fractional upper bound", expr: "sum(i, 1, 3.5, i)", expected: 6},
+		{name: "empty sum", expr: "sum(i, 3, 1, i)", expected: 0},
+		{name: "empty product", expr: "prod(i, 3, 1, i)", expected: 1},
+		{name: "nested sums", expr: "sum(i, 1, 3, sum(j, 1, i, j))", expected: 10},
+		{name: "shadowed variable", expr: "sum(i, 1, 2, sum(i, 1, 3, i))", expected: 12},
+		{name: "construct in arithmetic", expr: "2 * sum(i, 1, 3, i) + 1", expected: 13},
+		{name: "product aggregate", expr: "prod([2, 3, 4])", expected: 24},
+		{name: "integral of square", expr: "integrate(x, 0, 1, x^2)", expected: 1.0 / 3},
+		{name: "integral of reciprocal", expr: "integrate(x, 1, 2, 1/x)", expected: math.Ln2},
+		{name: "reversed integral", expr: "integrate(x, 1, 0, 3*x^2)", expected: -1},
+		{name: "unknown variable", expr: "sum(i, 1, 3, j)", wantErr: true},
+		{name: "variable outside its construct", expr: "sum(i, 1, 3, i) + i", wantErr: true},
+		{name: "missing body", expr: "sum(i, 1, 3)", wantErr: true},
+		{name: "integrate without variable", expr: "integrate(1, 2)", wantErr: true},
+		{name: "list bounds", expr: "sum(i, [1], 3, i)", wantErr: true},
+		{name: "list body", expr: "sum(i, 1, 3, [i, i])", wantErr: true},
+		{name: "division by zero in body", expr: "sum(i, 0, 3, 1/i)", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := calculation.EvaluateExpression(tt.expr)
+
+			if tt.wantErr {
+				assert.Error(t, err, "Expected error for expression: %s", tt.expr)
+				return
+			}
+
+			require.NoError(t, err, "Unexpected error for expression: %s", tt.expr)
+			assert.InDelta(t, tt.expected, result, 1e-9, "Unexpected result for expression: %s", tt.expr)
+		})
+	}
+}
+
+func TestEvaluateContext_BoundConstructLimits(t *testing.T) {
+	t.Parallel()
+
+	limits := calculation.Limits{MaxElements: 1000}
+
+	_, err := calculation.EvaluateContext(context.Background(), "sum(i, 1, 1000000000, i)", limits)
+	assert.ErrorIs(t, err, calculation.ErrMaxElementsExceeded)
+
+	_, err = calculation.EvaluateContext(context.Background(), "integrate(x, 0, 1, 1/(x+0.000001))", calculation.Limits{MaxElements: 10})
+	assert.ErrorIs(t, err, calculation.ErrMaxElementsExceeded)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = calculation.EvaluateContext(ctx, "sum(i, 1, 1000000000, i)", calculation.Limits{})
+	var canceledErr *calculation.CanceledError
+	assert.True(t, errors.As(err, &canceledErr))
+}
+
+func TestSplitSeries(t *testing.T) {
+	t.Parallel()
+
+	series, ok, err := calculation.SplitSeries(context.Background(), "sum(i, 1, 3, 2*i - i^2 + 3!)", calculation.Limits{})
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "+", series.Op)
+	assert.Equal(t, [][]string{
+		{"2", "1", "*", "1", "2", "^", "-", "6", "+"},
+		{"2", "2", "*", "2", "2", "^", "-", "6", "+"},
+		{"2", "3", "*", "3", "2", "^", "-", "6", "+"},
+	}, series.Terms)
+
+	series, ok, err = calculation.SplitSeries(context.Background(), "prod(k, 1, 2, -(k+1))", calculation.Limits{})
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "*", series.Op)
+	assert.Equal(t, [][]string{{"1", "1", "+", "-1", "*"}, {"2", "1", "+", "-1", "*"}}, series.Terms)
+
+	for _, expr := range []string{"2 * 3", "sum(i, 1, 3, i) + 1", "integrate(x, 0, 1, x)", "sum([1, 2])"} {
+		_, ok, err := calculation.SplitSeries(context.Background(), expr, calculation.Limits{})
+		require.NoError(t, err, "expression: %s", expr)
+		assert.False(t, ok, "expression: %s", expr)
+	}
+
+	_, _, err = calculation.SplitSeries(context.Background(), "sum(i, 1, 100, i)", calculation.Limits{MaxElements: 10})
+	assert.ErrorIs(t, err, calculation.ErrMaxElementsExceeded)
+}
+
+func TestEvaluateWithTrace_BoundConstruct(t *testing.T) {
+	t.Parallel()
+
+	steps, err := calculation.EvaluateWithTrace("sum(i, 1, 1+2, i*2) + 1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"sum(i, 1, 1+2, i*2)+1", "sum(i, 1, 3, i*2)+1", "12+1", "13"}, steps)
+}
+
+func TestTranslateNatural(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		phrase   string
+		expected string
+		wantErr  string
+	}{
+		{name: "russian product", phrase: "двадцать пять умножить на три", expected: "25 * 3"},
+		{name: "english precedence", phrase: "two plus three times four", expected: "2 + 3 * 4"},
+		{name: "fillers and question mark", phrase: "Сколько будет сто двадцать три плюс две тысячи пять?", expected: "123 + 2005"},
+		{name: "english hundred and", phrase: "one hundred and five divided by five", expected: "105 / 5"},
+		{name: "english scales", phrase: "two million three hundred thousand", expected: "2300000"},
+		{name: "russian scales", phrase: "два миллиона триста тысяч", expected: "2300000"},
+		{name: "decimal point", phrase: "three point one four times two", expected: "3.14 * 2"},
+		{name: "russian fractions", phrase: "две целых пять десятых минус ноль целых пять сотых", expected: "2.5 - 0.05"},
+		{name: "parentheses", phrase: "open parenthesis two plus three close parenthesis times four", expected: "( 2 + 3 ) * 4"},
+		{name: "power words", phrase: "два в степени три плюс пять в квадрате", expected: "2 ^ 3 + 5 ^ 2"},
+		{name: "digits and symbols are kept", phrase: "минус 5 плюс (три)", expected: "- 5 + ( 3 )"},
+		{name: "letter yo", phrase: "шесть делённое на два", expected: "6 / 2"},
+		{name: "hyphenated compound", phrase: "sixty-six plus Twenty-One", expected: "66 + 21"},
+		{name: "hyphen between numbers", phrase: "sixty-ten", expected: "60 - 10"},
+		{name: "factorial is not translated", phrase: "five factorial", wantErr: `unknown word "factorial" at position 5`},
+		{name: "unknown word", phrase: "a plus b", wantErr: `unknown word "a" at position 0`},
+		{name: "misplaced tens", phrase: "twenty thirty", wantErr: `misplaced number word "thirty" at position 7`},
+		{name: "misplaced units", phrase: "пять три", wantErr: `misplaced number word "три" at position 9`},
+		{name: "decreasing scales", phrase: "thousand million", wantErr: `misplaced number word "million" at position 9`},
+		{name: "point without digits", phrase: "three point", wantErr: `misplaced number word "point" at position 6`},
+		{name: "only fillers", phrase: "what is", wantErr: "phrase contains no expression"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			expression, err := calculation.TranslateNatural(tt.phrase)
+
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Equal(t, tt.wantErr, err.Error())
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, expression)
+		})
+	}
+
+	expression, err := calculation.TranslateNatural("two plus three times four")
+	require.NoError(t, err)
+	result, err := calculation.EvaluateExpression(expression)
+	require.NoError(t, err)
+	assert.Equal(t, 14.0, result)
+}
@@ -0,0 +1,164 @@
+package test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/flexer2006/y.lms-sprint2-calculator/pkg/calculation"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func collectTokens(t *testing.T, lexer *calculation.Lexer) []calculation.Token {
+	t.Helper()
+
+	var tokens []calculation.Token
+	for {
+		token, err := lexer.Next()
+		require.NoError(t, err)
+		if token.Kind == calculation.TokenEOF {
+			return tokens
+		}
+		tokens = append(tokens, token)
+	}
+}
+
+func TestLexer_Tokens(t *testing.T) {
+	t.Parallel()
+
+	tokens := collectTokens(t, calculation.NewStringLexer("(2.5 + |-3|)² * 4!"))
+
+	expected := []calculation.Token{
+		{Kind: calculation.TokenLeftParen, Text: "(", Pos: 0},
+		{Kind: calculation.TokenNumber, Text: "2.5", Pos: 1},
+		{Kind: calculation.TokenOperator, Text: "+", Pos: 5},
+		{Kind: calculation.TokenAbs, Text: "|", Pos: 7},
+		{Kind: calculation.TokenOperator, Text: "-", Pos: 8},
+		{Kind: calculation.TokenNumber, Text: "3", Pos: 9},
+		{Kind: calculation.TokenAbs, Text: "|", Pos: 10},
+		{Kind: calculation.TokenRightParen, Text: ")", Pos: 11},
+		{Kind: calculation.TokenPostfix, Text: "²", Pos: 12},
+		{Kind: calculation.TokenOperator, Text: "*", Pos: 15},
+		{Kind: calculation.TokenNumber, Text: "4", Pos: 17},
+		{Kind: calculation.TokenPostfix, Text: "!", Pos: 18},
+	}
+	assert.Equal(t, expected, tokens)
+}
+
+func TestLexer_ListTokens(t *testing.T) {
+	t.Parallel()
+
+	tokens := collectTokens(t, calculation.NewStringLexer("sum([1.5, 2..10])"))
+
+	expected := []calculation.Token{
+		{Kind: calculation.TokenIdent, Text: "sum", Pos: 0},
+		{Kind: calculation.TokenLeftParen, Text: "(", Pos: 3},
+		{Kind: calculation.TokenLeftBracket, Text: "[", Pos: 4},
+		{Kind: calculation.TokenNumber, Text: "1.5", Pos: 5},
+		{Kind: calculation.TokenComma, Text: ",", Pos: 8},
+		{Kind: calculation.TokenNumber, Text: "2", Pos: 10},
+		{Kind: calculation.TokenRange, Text: "..", Pos: 11},
+		{Kind: calculation.TokenNumber, Text: "10", Pos: 13},
+		{Kind: calculation.TokenRightBracket, Text: "]", Pos: 15},
+		{Kind: calculation.TokenRightParen, Text: ")", Pos: 16},
+	}
+	assert.Equal(t, expected, tokens)
+}
+
+func TestLexer_Reader(t *testing.T) {
+	t.Parallel()
+
+	tokens := collectTokens(t, calculation.NewLexer(strings.NewReader("10 / 2")))
+
+	require.Len(t, tokens, 3)
+	assert.Equal(t, calculation.TokenNumber, tokens[0].Kind)
+	assert.Equal(t, "10", tokens[0].Text)
+	assert.Equal(t, calculation.TokenOperator, tokens[1].Kind)
+	assert.Equal(t, 3, tokens[1].Pos)
+	assert.Equal(t, "2", tokens[2].Text)
+}
+
+func TestLexer_Errors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		input   string
+		wantPos int
+		wantMsg string
+	}{
+		{
+			name:    "invalid character",
+			input:   "2 + $",
+			wantPos: 4,
+			wantMsg: `unexpected character "$" at position 4`,
+		},
+		{
+			name:    "malformed number",
+			input:   "1 + 2.2.2",
+			wantPos: 4,
+			wantMsg: `malformed number "2.2.2" at position 4`,
+		},
+		{
+			name:    "lone decimal point",
+			input:   ". + 1",
+			wantPos: 0,
+			wantMsg: `malformed number "." at position 0`,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			lexer := calculation.NewStringLexer(tt.input)
+
+			token, err := lexer.Next()
+			for err == nil && token.Kind != calculation.TokenEOF {
+				token, err = lexer.Next()
+			}
+
+			require.Error(t, err)
+			assert.Equal(t, calculation.TokenInvalid, token.Kind)
+			assert.Equal(t, tt.wantMsg, err.Error())
+
+			var syntaxErr *calculation.SyntaxError
+			require.True(t, errors.As(err, &syntaxErr))
+			assert.Equal(t, tt.wantPos, syntaxErr.Pos)
+		})
+	}
+}
+
+func TestLexer_ContinuesAfterError(t *testing.T) {
+	t.Parallel()
+
+	lexer := calculation.NewStringLexer("1 # 2")
+
+	token, err := lexer.Next()
+	require.NoError(t, err)
+	assert.Equal(t, "1", token.Text)
+
+	token, err = lexer.Next()
+	require.Error(t, err)
+	assert.Equal(t, calculation.TokenInvalid, token.Kind)
+	assert.Equal(t, "#", token.Text)
+
+	token, err = lexer.Next()
+	require.NoError(t, err)
+	assert.Equal(t, calculation.TokenNumber, token.Kind)
+	assert.Equal(t, "2", token.Text)
+	assert.Equal(t, 4, token.Pos)
+
+	token, err = lexer.Next()
+	require.NoError(t, err)
+	assert.Equal(t, calculation.TokenEOF, token.Kind)
+}
+
+func TestEvaluateExpression_DescriptiveLexerError(t *testing.T) {
+	t.Parallel()
+
+	_, err := calculation.EvaluateExpression("2 + $")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `unexpected character "$" at position 4`)
+}
@@ -73,6 +73,14 @@ func TestExpressionValidation(t *testing.T) {
 		{"Unary minus on entire expression", "-(1+2)", http.StatusCreated, ""},
 		{"Multiple unary minus inside parentheses", "(-1+(2*(3-(-4))))", http.StatusCreated, ""},
 		{"Redundant parentheses", "((1+2))", http.StatusCreated, ""},
+		{"Power", "2^10", http.StatusCreated, ""},
+		{"Power with negative exponent", "2^-1", http.StatusCreated, ""},
+		{"Unary minus after spaced operator", "2 * -3", http.StatusCreated, ""},
+		{"Unary minus after spaced parenthesis", "( -2) ^ 2", http.StatusCreated, ""},
+		{"Spaced unary minus at beginning", " - 2 + 3", http.StatusCreated, ""},
+		{"Spaced power with negative exponent", "2 ^ - 1", http.StatusCreated, ""},
+		{"Modulo", "7%3", http.StatusCreated, ""},
+		{"Power and modulo with parentheses", "(2^3+1)%4*2", http.StatusCreated, ""},
 
 		{"Double decimal point", "1.2.3+4", http.StatusUnprocessableEntity, "invalid expression: invalid number format"},
 		{"Only operator", "+", http.StatusUnprocessableEntity, "invalid expression: too few tokens"},
@@ -83,33 +91,84 @@ func TestExpressionValidation(t *testing.T) {
 		{"Consecutive operators", "1+-+2", http.StatusUnprocessableEntity, "invalid expression: invalid structure"},
 		{"Empty parentheses", "()", http.StatusUnprocessableEntity, "invalid expression: empty expression"},
 		{"Multiple unary minus", "--1+2", http.StatusUnprocessableEntity, "invalid expression: invalid structure"},
+		{"Spaced multiple unary minus", "2 * - -3", http.StatusUnprocessableEntity, "invalid expression: invalid structure"},
+		{"Spaced double minus", "2 - - 3", http.StatusUnprocessableEntity, "invalid expression: invalid structure"},
+		{"Trailing power", "2^", http.StatusUnprocessableEntity, "invalid expression: too few tokens"},
+		{"Consecutive power and modulo", "2^%3", http.StatusUnprocessableEntity, "invalid expression: invalid structure"},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			t.Parallel()
-			reqBody, _ := json.Marshal(models.CalculateRequest{Expression: tc.expression})
-			req, err := http.NewRequest(http.MethodPost, "/api/v1/calculate", bytes.NewBuffer(reqBody))
-			assert.NoError(t, err)
-			req.Header.Set("Content-Type", "application/json")
-
-			rr := httptest.NewRecorder()
-			handler.ServeHTTP(rr, req)
-
-			assert.Equal(t, tc.expectedStatus, rr.Code)
-
-			var respBody map[string]interface{}
-			err = json.Unmarshal(rr.Body.Bytes(), &respBody)
-			assert.NoError(t, err)
-
-			if tc.expectedStatus != http.StatusCreated {
-				errorMsg, ok := respBody["error"].(string)
-				assert.True(t, ok)
-				assert.Contains(t, errorMsg, tc.expectedError)
-			} else {
-				_, hasID := respBody["id"]
-				assert.True(t, hasID, "Response should contain expression ID")
-			}
+			assertCalculateResponse(t, handler, models.CalculateRequest{Expression: tc.expression},
+				tc.expectedStatus, tc.expectedError)
 		})
 	}
 }
+
+func TestNotationValidation(t *testing.T) {
+	handler := setupTestServer2(t)
+
+	tests := []struct {
+		name           string
+		expression     string
+		notation       string
+		expectedStatus int
+		expectedError  string
+	}{
+		{"Explicit infix", "1+2*3", models.NotationInfix, http.StatusCreated, ""},
+		{"RPN", "2 3 4 * +", models.NotationRPN, http.StatusCreated, ""},
+		{"RPN with negative number", "-2 3 -", models.NotationRPN, http.StatusCreated, ""},
+		{"RPN single number", "42", models.NotationRPN, http.StatusCreated, ""},
+		{"Prefix", "+ 2 * 3 4", models.NotationPrefix, http.StatusCreated, ""},
+		{"Prefix nested", "/ - 10 4 + 1 2", models.NotationPrefix, http.StatusCreated, ""},
+		{"RPN power and modulo", "2 10 ^ 7 %", models.NotationRPN, http.StatusCreated, ""},
+
+		{"RPN missing operand", "2 +", models.NotationRPN, http.StatusUnprocessableEntity, `invalid expression: missing operand for "+"`},
+		{"RPN too many operands", "2 3", models.NotationRPN, http.StatusUnprocessableEntity, "invalid expression: too many operands"},
+		{"RPN infix input", "2+3", models.NotationRPN, http.StatusUnprocessableEntity, `invalid expression: invalid token "2+3"`},
+		{"RPN exponent", "1e5 1 +", models.NotationRPN, http.StatusUnprocessableEntity, `invalid expression: invalid token "1e5"`},
+		{"RPN empty", "   ", models.NotationRPN, http.StatusUnprocessableEntity, "invalid expression: empty expression"},
+		{"Prefix missing operand", "+ 2", models.NotationPrefix, http.StatusUnprocessableEntity, `invalid expression: missing operand for "+"`},
+		{"Prefix written as RPN", "2 3 +", models.NotationPrefix, http.StatusUnprocessableEntity, `invalid expression: missing operand for "+"`},
+		{"Unknown notation", "2 3 +", "postfix", http.StatusUnprocessableEntity, `unknown input notation "postfix"`},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			assertCalculateResponse(t, handler, models.CalculateRequest{Expression: tc.expression, Notation: tc.notation},
+				tc.expectedStatus, tc.expectedError)
+		})
+	}
+}
+
+// assertCalculateResponse posts calcReq to /api/v1/calculate and checks the status:
+// a created expression must have an ID, a rejected one an error containing expectedError.
+func assertCalculateResponse(t *testing.T, handler http.Handler, calcReq models.CalculateRequest,
+	expectedStatus int, expectedError string) {
+	t.Helper()
+
+	reqBody, _ := json.Marshal(calcReq)
+	req, err := http.NewRequest(http.MethodPost, "/api/v1/calculate", bytes.NewBuffer(reqBody))
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, expectedStatus, rr.Code)
+
+	var respBody map[string]interface{}
+	err = json.Unmarshal(rr.Body.Bytes(), &respBody)
+	assert.NoError(t, err)
+
+	if expectedStatus != http.StatusCreated {
+		errorMsg, ok := respBody["error"].(string)
+		assert.True(t, ok)
+		assert.Contains(t, errorMsg, expectedError)
+	} else {
+		_, hasID := respBody["id"]
+		assert.True(t, hasID, "Response should contain expression ID")
+	}
+}
@@ -3,15 +3,21 @@ package test
 import (
 	"bytes"
 	"encoding/json"
+	"math"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/flexer2006/y.lms-sprint2-calculator/common"
 	"github.com/flexer2006/y.lms-sprint2-calculator/configs"
 	"github.com/flexer2006/y.lms-sprint2-calculator/internal/logger"
 	"github.com/flexer2006/y.lms-sprint2-calculator/internal/server"
 	"github.com/flexer2006/y.lms-sprint2-calculator/internal/server/models"
+	"github.com/flexer2006/y.lms-sprint2-calculator/pkg/calculation"
 
 	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
@@ -93,6 +99,20 @@ func TestServer_HandleCalculate(t *testing.T) {
 				assert.Contains(t, resp["error"], "invalid expression: invalid structure")
 			},
 		},
+		{
+			name: "invalid format options",
+			request: models.CalculateRequest{
+				Expression: "2 + 2",
+				Format:     &models.FormatOptions{Digits: 2, Rounding: "ceiling"},
+			},
+			expectedStatus: http.StatusUnprocessableEntity,
+			validateResp: func(t *testing.T, w *httptest.ResponseRecorder) {
+				var resp map[string]string
+				err := json.NewDecoder(w.Body).Decode(&resp)
+				require.NoError(t, err)
+				assert.Contains(t, resp["error"], "invalid rounding mode")
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -226,6 +246,31 @@ func TestServer_HandleGetTask(t *testing.T) {
 	}
 }
 
+func TestServer_TaskOperationTime(t *testing.T) {
+	_, router := setupTestServer(t)
+
+	body, err := json.Marshal(models.CalculateRequest{Expression: "2 * 3"})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/calculate", bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	time.Sleep(100 * time.Millisecond)
+
+	req = httptest.NewRequest(http.MethodGet, "/internal/task", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var payload struct {
+		Task map[string]json.RawMessage `json:"task"`
+	}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&payload))
+	assert.JSONEq(t, "200", string(payload.Task["operation_time"]), "multiplication time comes from the server config")
+}
+
 func TestServer_HandleSubmitTaskResult(t *testing.T) {
 
 	_, router := setupTestServer(t)
@@ -263,8 +308,9 @@ func TestServer_HandleSubmitTaskResult(t *testing.T) {
 taskFound:
 
 	result := models.TaskResult{
-		ID:     taskResp.Task.ID,
-		Result: 4.0,
+		ID:         taskResp.Task.ID,
+		Result:     4.0,
+		LeaseToken: taskResp.Task.LeaseToken,
 	}
 	body, err = json.Marshal(result)
 	require.NoError(t, err)
@@ -275,6 +321,363 @@ taskFound:
 	require.Equal(t, http.StatusOK, w.Code)
 }
 
+func TestServer_TaskLease(t *testing.T) {
+	_, router := setupTestServer(t)
+
+	calculate(t, router, "2 + 3")
+	task := takeTask(t, router)
+	require.NotEmpty(t, task.LeaseToken)
+
+	leasePath := "/internal/task/" + task.ID + "/lease"
+	assert.Equal(t, http.StatusOK, postJSON(t, router, leasePath, models.LeaseRequest{LeaseToken: task.LeaseToken}).Code)
+	assert.Equal(t, http.StatusConflict, postJSON(t, router, leasePath, models.LeaseRequest{LeaseToken: "wrong-token"}).Code)
+
+	assert.Equal(t, http.StatusConflict,
+		submit(t, router, models.TaskResult{ID: task.ID, Result: 5, LeaseToken: "wrong-token"}))
+	assert.Equal(t, http.StatusOK,
+		submit(t, router, models.TaskResult{ID: task.ID, Result: 5, LeaseToken: task.LeaseToken}))
+	assert.Equal(t, http.StatusConflict, postJSON(t, router, leasePath, models.LeaseRequest{LeaseToken: task.LeaseToken}).Code,
+		"the lease ends with the result")
+}
+
+func TestServer_DeadLetters(t *testing.T) {
+	router := newTestRouter(t, &configs.ServerConfig{Port: "8080", LeaseTimeoutMS: 20, MaxAttempts: 1})
+
+	id := calculate(t, router, "2 + 3")
+
+	// Агент взял задачу и пропал: после истечения аренды единственная попытка исчерпана.
+	takeTask(t, router)
+	time.Sleep(30 * time.Millisecond)
+	assert.Empty(t, computeQueuedTasks(t, router))
+
+	expr := getExpression(t, router, id)
+	assert.Equal(t, models.StatusError, expr.Status)
+	assert.Equal(t, `operation "+" failed after 1 attempts: task lease expired`, expr.Error)
+
+	var lettersResp models.DeadLettersResponse
+	getJSON(t, router, "/internal/dead-letters", &lettersResp)
+	require.Len(t, lettersResp.DeadLetters, 1)
+	letter := lettersResp.DeadLetters[0]
+	assert.Equal(t, expr.Error, letter.Reason)
+
+	assert.Equal(t, http.StatusNotFound, postJSON(t, router, "/internal/dead-letters/non-existent/requeue", nil).Code)
+	require.Equal(t, http.StatusOK, postJSON(t, router, "/internal/dead-letters/"+letter.Task.ID+"/requeue", nil).Code)
+	assert.Equal(t, models.StatusProgress, getExpression(t, router, id).Status)
+
+	assert.Equal(t, map[string]int{"+": 1}, computeQueuedTasks(t, router))
+	expr = getExpression(t, router, id)
+	require.Equal(t, models.StatusComplete, expr.Status)
+	assert.Equal(t, 5.0, *expr.Result)
+}
+
+func TestServer_TaskFailure(t *testing.T) {
+	_, router := setupTestServer(t)
+
+	id := calculate(t, router, "(1+2)*(4/(2-2))")
+
+	tasks := map[string]models.Task{}
+	for range 2 {
+		task := takeTask(t, router)
+		tasks[task.Operation] = task
+	}
+	require.Contains(t, tasks, "+")
+	require.Contains(t, tasks, "-")
+
+	sub := tasks["-"]
+	require.Equal(t, http.StatusOK, submit(t, router, models.TaskResult{ID: sub.ID, Result: 0, LeaseToken: sub.LeaseToken}))
+
+	div := takeTask(t, router)
+	require.Equal(t, "/", div.Operation)
+
+	// Отказ без аренды задачи не принимается.
+	assert.Equal(t, http.StatusConflict, submit(t, router, models.TaskResult{ID: div.ID, Error: common.ErrDivisionByZero}))
+	require.Equal(t, http.StatusOK,
+		submit(t, router, models.TaskResult{ID: div.ID, Error: common.ErrDivisionByZero, LeaseToken: div.LeaseToken}))
+
+	expr := getExpression(t, router, id)
+	assert.Equal(t, models.StatusError, expr.Status)
+	assert.Equal(t, common.ErrDivisionByZero, expr.Error)
+
+	// Остальные задачи выражения отменены: умножение не попадает в очередь,
+	// а опоздавший результат сложения отклоняется.
+	assert.Empty(t, computeQueuedTasks(t, router))
+	add := tasks["+"]
+	assert.Equal(t, http.StatusConflict, submit(t, router, models.TaskResult{ID: add.ID, Result: 3, LeaseToken: add.LeaseToken}))
+}
+
+func TestServer_CancelExpression(t *testing.T) {
+	_, router := setupTestServer(t)
+
+	body, err := json.Marshal(models.CalculateRequest{Expression: "(1+2)*(3+4)"})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/calculate", bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	var calcResp models.CalculateResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&calcResp))
+
+	time.Sleep(100 * time.Millisecond)
+
+	req = httptest.NewRequest(http.MethodGet, "/internal/task", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var taskResp models.TaskResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&taskResp))
+
+	req = httptest.NewRequest(http.MethodDelete, "/api/v1/expressions/non-existent", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	req = httptest.NewRequest(http.MethodDelete, "/api/v1/expressions/"+calcResp.ID, nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var exprResp models.ExpressionResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&exprResp))
+	assert.Equal(t, models.StatusCancelled, exprResp.Expression.Status)
+
+	// Невыданные задачи убраны из очереди, а результат выданной отклоняется.
+	assert.Empty(t, computeQueuedTasks(t, router))
+
+	body, err = json.Marshal(models.TaskResult{ID: taskResp.Task.ID, Result: 3, LeaseToken: taskResp.Task.LeaseToken})
+	require.NoError(t, err)
+	req = httptest.NewRequest(http.MethodPost, "/internal/task", bytes.NewBuffer(body))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	req = httptest.NewRequest(http.MethodDelete, "/api/v1/expressions/"+calcResp.ID, nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/expressions/"+calcResp.ID, nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&exprResp))
+	assert.Equal(t, models.StatusCancelled, exprResp.Expression.Status)
+}
+
+func TestServer_ExpressionTimeout(t *testing.T) {
+	router := newTestRouter(t, &configs.ServerConfig{Port: "8080", DefaultTimeoutMS: 500, MaxTimeoutMS: 1000})
+
+	assert.Equal(t, http.StatusUnprocessableEntity,
+		postJSON(t, router, "/api/v1/calculate", models.CalculateRequest{Expression: "1+2", TimeoutMS: -1}).Code)
+
+	// Время по умолчанию и ограничение сверху.
+	for _, tc := range []struct {
+		requested int64
+		expected  int64
+	}{
+		{requested: 0, expected: 500},
+		{requested: 5000, expected: 1000},
+		{requested: 300, expected: 300},
+	} {
+		w := postJSON(t, router, "/api/v1/calculate", models.CalculateRequest{Expression: "1+2", TimeoutMS: tc.requested})
+		require.Equal(t, http.StatusCreated, w.Code)
+
+		var calcResp models.CalculateResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&calcResp))
+		assert.Equal(t, tc.expected, getExpression(t, router, calcResp.ID).TimeoutMS)
+	}
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, map[string]int{"+": 3}, computeQueuedTasks(t, router))
+
+	w := postJSON(t, router, "/api/v1/calculate", models.CalculateRequest{Expression: "(1+2)*(3+4)", TimeoutMS: 100})
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	var calcResp models.CalculateResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&calcResp))
+
+	time.Sleep(50 * time.Millisecond)
+
+	// Агенты успели выполнить одно сложение из трех задач.
+	completeTask(t, router, takeTask(t, router), 3)
+
+	time.Sleep(100 * time.Millisecond)
+
+	expr := getExpression(t, router, calcResp.ID)
+	assert.Equal(t, models.StatusTimeout, expr.Status)
+	assert.Equal(t, "expression timed out after 100 ms", expr.Error)
+	assert.Equal(t, &models.Progress{CompletedTasks: 1, TotalTasks: 3}, expr.Progress)
+	assert.Empty(t, computeQueuedTasks(t, router))
+}
+
+func TestServer_ExpressionTimeoutBounds(t *testing.T) {
+	_, router := setupTestServer(t)
+
+	for _, tc := range []struct {
+		timeoutMS int64
+		expected  int
+	}{
+		{timeoutMS: math.MaxInt64, expected: http.StatusUnprocessableEntity},
+		{timeoutMS: math.MaxInt64/int64(time.Millisecond) + 1, expected: http.StatusUnprocessableEntity},
+		{timeoutMS: math.MaxInt64 / int64(time.Millisecond), expected: http.StatusCreated},
+	} {
+		w := postJSON(t, router, "/api/v1/calculate", models.CalculateRequest{Expression: "1+2", TimeoutMS: tc.timeoutMS})
+		assert.Equal(t, tc.expected, w.Code, "timeout: %d", tc.timeoutMS)
+	}
+
+	// Наибольший срок не переполняется и не прерывает выражение сразу.
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, map[string]int{"+": 1}, computeQueuedTasks(t, router))
+}
+
+func TestServer_ExpressionPriority(t *testing.T) {
+	_, router := setupTestServer(t)
+
+	ids := map[string]string{}
+	for _, req := range []models.CalculateRequest{
+		{Expression: "1+2", Priority: -1},
+		{Expression: "3-4"},
+		{Expression: "5*6", Priority: 10},
+	} {
+		body, err := json.Marshal(req)
+		require.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/calculate", bytes.NewBuffer(body)))
+		require.Equal(t, http.StatusCreated, w.Code)
+
+		var calcResp models.CalculateResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&calcResp))
+		ids[calcResp.ID] = req.Expression
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	var order []string
+	for {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/internal/task", nil))
+		if w.Code != http.StatusOK {
+			break
+		}
+
+		var taskResp models.TaskResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&taskResp))
+		order = append(order, ids[taskResp.Task.ExpressionID])
+	}
+	assert.Equal(t, []string{"5*6", "3-4", "1+2"}, order)
+}
+
+func TestServer_CriticalPathFirst(t *testing.T) {
+	_, router := setupTestServer(t)
+
+	// Сложение 1+2 стоит в плане первым, но цепочка 3*4*5 длиннее:
+	// 200+200+100 мс против 100+100 мс.
+	body, err := json.Marshal(models.CalculateRequest{Expression: "1+2+3*4*5"})
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/calculate", bytes.NewBuffer(body)))
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	time.Sleep(100 * time.Millisecond)
+
+	var dispatched []models.Task
+	for {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/internal/task", nil))
+		if w.Code != http.StatusOK {
+			break
+		}
+
+		var taskResp models.TaskResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&taskResp))
+		dispatched = append(dispatched, taskResp.Task)
+	}
+
+	require.Len(t, dispatched, 2)
+	assert.Equal(t, "*", dispatched[0].Operation)
+	assert.Equal(t, int64(500), dispatched[0].CriticalPathMS)
+	assert.Equal(t, "+", dispatched[1].Operation)
+	assert.Equal(t, int64(200), dispatched[1].CriticalPathMS)
+}
+
+func TestServer_FusedTasks(t *testing.T) {
+	newRouter := func(computingPower int64) http.Handler {
+		return newTestRouter(t, &configs.ServerConfig{
+			Port:              "8080",
+			TimeAdditionMS:    100,
+			TimeSubtractionMS: 100,
+			TimeMultiplyMS:    200,
+			ComputingPower:    computingPower,
+		})
+	}
+	t.Run("single computing unit gets the whole expression", func(t *testing.T) {
+		router := newRouter(1)
+		id := calculate(t, router, "(1+2)*(3+4)-5")
+
+		tasks := queuedTasks(t, router)
+		require.Len(t, tasks, 1)
+		assert.Equal(t, "-", tasks[0].Operation)
+		assert.Equal(t, []string{"1", "2", "+", "3", "4", "+", "*", "5", "-"}, tasks[0].Fragment)
+		assert.Equal(t, int64(500), tasks[0].OperationTime)
+		completeTask(t, router, tasks[0], 16)
+
+		expr := getExpression(t, router, id)
+		require.Equal(t, models.StatusComplete, expr.Status)
+		assert.Equal(t, 16.0, *expr.Result)
+
+		var stepsResp models.StepsResponse
+		getJSON(t, router, "/api/v1/expressions/"+id+"/steps", &stepsResp)
+		assert.Equal(t, []string{"(1+2)*(3+4)-5", "16"}, stepsResp.Steps)
+	})
+
+	t.Run("work is split between computing units", func(t *testing.T) {
+		// 7 операций по 100 и 200 мс на два вычислителя: каждая сумма в скобках
+		// укладывается в половину работы, а корневое умножение - уже нет.
+		router := newRouter(2)
+		id := calculate(t, router, "((1+2)+(3+4))*((5+6)+(7+8))")
+
+		tasks := queuedTasks(t, router)
+		require.Len(t, tasks, 2)
+		for i, fragment := range [][]string{{"1", "2", "+", "3", "4", "+", "+"}, {"5", "6", "+", "7", "8", "+", "+"}} {
+			assert.Equal(t, fragment, tasks[i].Fragment)
+			assert.Equal(t, int64(300), tasks[i].OperationTime)
+		}
+		completeTask(t, router, tasks[0], 10)
+		completeTask(t, router, tasks[1], 26)
+
+		tasks = queuedTasks(t, router)
+		require.Len(t, tasks, 1)
+		assert.Equal(t, "*", tasks[0].Operation)
+		assert.Empty(t, tasks[0].Fragment)
+		completeTask(t, router, tasks[0], 260)
+
+		var stepsResp models.StepsResponse
+		getJSON(t, router, "/api/v1/expressions/"+id+"/steps", &stepsResp)
+		assert.Equal(t, []string{"(1+2+(3+4))*(5+6+(7+8))", "10*(5+6+(7+8))", "10*26", "260"}, stepsResp.Steps)
+	})
+
+	t.Run("task arguments and shared subexpressions", func(t *testing.T) {
+		// Общее сложение нужно двум задачам и остается отдельной задачей.
+		router := newRouter(1)
+		calculate(t, router, "(1+2)*3-(2+1)")
+
+		tasks := queuedTasks(t, router)
+		require.Len(t, tasks, 1)
+		assert.Equal(t, "+", tasks[0].Operation)
+		assert.Empty(t, tasks[0].Fragment)
+		completeTask(t, router, tasks[0], 3)
+
+		tasks = queuedTasks(t, router)
+		require.Len(t, tasks, 1)
+		assert.Equal(t, []string{models.FragmentArg1, "3", "*", models.FragmentArg1, "-"}, tasks[0].Fragment)
+		assert.Equal(t, 3.0, *tasks[0].Arg1.Value)
+		assert.Equal(t, int64(300), tasks[0].OperationTime)
+	})
+}
+
 func TestServer_Integration(t *testing.T) {
 	_, router := setupTestServer(t)
 
@@ -304,8 +707,9 @@ func TestServer_Integration(t *testing.T) {
 	require.NoError(t, err)
 
 	result := models.TaskResult{
-		ID:     taskResp.Task.ID,
-		Result: 4.0,
+		ID:         taskResp.Task.ID,
+		Result:     4.0,
+		LeaseToken: taskResp.Task.LeaseToken,
 	}
 	body, err = json.Marshal(result)
 	require.NoError(t, err)
@@ -344,3 +748,586 @@ func TestServer_Integration(t *testing.T) {
 		}
 	}
 }
+
+// computeQueuedTasks plays the part of an agent: it takes tasks from the queue
+// and submits their results until the queue is empty. It returns the number
+// of tasks computed for each operation.
+func computeQueuedTasks(t *testing.T, router http.Handler) map[string]int {
+	t.Helper()
+
+	operations := map[string]int{}
+	for {
+		req := httptest.NewRequest(http.MethodGet, "/internal/task", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			return operations
+		}
+
+		var taskResp models.TaskResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&taskResp))
+		task := taskResp.Task
+		operations[task.Operation]++
+
+		arg1, ok1 := task.Arg1.Number()
+		arg2, ok2 := task.Arg2.Number()
+		require.True(t, ok1 && ok2, "queued task %s has unresolved operands", task.ID)
+
+		var result float64
+		switch task.Operation {
+		case "+":
+			result = arg1 + arg2
+		case "-":
+			result = arg1 - arg2
+		case "*":
+			result = arg1 * arg2
+		case "/":
+			result = arg1 / arg2
+		case "^":
+			result = math.Pow(arg1, arg2)
+		case "%":
+			result = math.Mod(arg1, arg2)
+		}
+		body, err := json.Marshal(models.TaskResult{ID: task.ID, Result: result, LeaseToken: task.LeaseToken})
+		require.NoError(t, err)
+
+		req = httptest.NewRequest(http.MethodPost, "/internal/task", bytes.NewBuffer(body))
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+}
+
+// newTestRouter creates a server with the given configuration and returns its router.
+func newTestRouter(t *testing.T, cfg *configs.ServerConfig) http.Handler {
+	t.Helper()
+
+	log, err := logger.New(logger.Options{Level: logger.Debug, Encoding: "json", OutputPath: []string{"stdout"}})
+	require.NoError(t, err)
+	return server.New(cfg, log).GetHandler()
+}
+
+// postJSON sends payload encoded as JSON to path and returns the response.
+func postJSON(t *testing.T, router http.Handler, path string, payload interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+
+	body, err := json.Marshal(payload)
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, bytes.NewBuffer(body)))
+	return w
+}
+
+// getJSON fetches url and decodes its JSON response into v.
+func getJSON(t *testing.T, router http.Handler, url string, v interface{}) {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.NewDecoder(w.Body).Decode(v))
+}
+
+// calculate submits an expression, waits for its tasks to be planned and
+// returns the expression ID.
+func calculate(t *testing.T, router http.Handler, expression string) string {
+	t.Helper()
+
+	w := postJSON(t, router, "/api/v1/calculate", models.CalculateRequest{Expression: expression})
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	var calcResp models.CalculateResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&calcResp))
+	time.Sleep(100 * time.Millisecond)
+	return calcResp.ID
+}
+
+// getExpression returns the expression with the given ID.
+func getExpression(t *testing.T, router http.Handler, id string) models.Expression {
+	t.Helper()
+
+	var exprResp models.ExpressionResponse
+	getJSON(t, router, "/api/v1/expressions/"+id, &exprResp)
+	return exprResp.Expression
+}
+
+// takeTask takes the next task from the queue, as an agent does.
+func takeTask(t *testing.T, router http.Handler) models.Task {
+	t.Helper()
+
+	var taskResp models.TaskResponse
+	getJSON(t, router, "/internal/task", &taskResp)
+	return taskResp.Task
+}
+
+// queuedTasks takes every task from the queue without submitting results.
+func queuedTasks(t *testing.T, router http.Handler) []models.Task {
+	t.Helper()
+
+	var tasks []models.Task
+	for {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/internal/task", nil))
+		if w.Code != http.StatusOK {
+			return tasks
+		}
+
+		var taskResp models.TaskResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&taskResp))
+		tasks = append(tasks, taskResp.Task)
+	}
+}
+
+// submit sends a task result or failure and returns the response status.
+func submit(t *testing.T, router http.Handler, result models.TaskResult) int {
+	t.Helper()
+
+	return postJSON(t, router, "/internal/task", result).Code
+}
+
+// completeTask submits the result of a leased task and requires it to be accepted.
+func completeTask(t *testing.T, router http.Handler, task models.Task, result float64) {
+	t.Helper()
+
+	require.Equal(t, http.StatusOK,
+		submit(t, router, models.TaskResult{ID: task.ID, Result: result, LeaseToken: task.LeaseToken}))
+}
+
+func TestServer_MatrixProduct(t *testing.T) {
+	_, router := setupTestServer(t)
+
+	body, err := json.Marshal(models.CalculateRequest{Expression: "[[1, 2], [3, 4]] * [[5, 6], [7, 8]]"})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/calculate", bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	var calcResp models.CalculateResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&calcResp))
+
+	time.Sleep(100 * time.Millisecond)
+
+	operations := computeQueuedTasks(t, router)
+
+	assert.Equal(t, 8, operations["*"], "each of the 4 cells needs 2 multiplications")
+	assert.Equal(t, 4, operations["+"], "each of the 4 cells needs 1 addition")
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/expressions/"+calcResp.ID, nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var exprResp models.ExpressionResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&exprResp))
+	assert.Equal(t, models.StatusComplete, exprResp.Expression.Status)
+	assert.Nil(t, exprResp.Expression.Result)
+	assert.Equal(t, [][]float64{{19, 22}, {43, 50}}, exprResp.Expression.Matrix)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/expressions/"+calcResp.ID+"/steps", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var stepsResp models.StepsResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&stepsResp))
+	require.NotEmpty(t, stepsResp.Steps)
+	assert.Equal(t, "[[1*5+2*7, 1*6+2*8], [3*5+4*7, 3*6+4*8]]", stepsResp.Steps[0])
+	assert.Equal(t, "[[19, 22], [43, 50]]", stepsResp.Steps[len(stepsResp.Steps)-1])
+}
+
+func TestServer_MatrixExpressionValidation(t *testing.T) {
+	_, router := setupTestServer(t)
+
+	for _, expression := range []string{
+		"[[1, 2]] * [[1, 2]]",
+		"[[1, 2]] + [[3, 4]]",
+		"det([[1, 2], [3, 4]])",
+	} {
+		body, err := json.Marshal(models.CalculateRequest{Expression: expression})
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/calculate", bytes.NewBuffer(body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code, "expression: %s", expression)
+	}
+}
+
+func TestServer_MatrixExpressionLimits(t *testing.T) {
+	_, router := setupTestServer(t)
+
+	for _, expression := range []string{
+		"[1..100000000000000000000] * [[1]]",
+		"[1..1000000000] * [[1]]",
+		"[[1..1000000]] * [[1]]",
+		strings.Repeat("(", 100) + "[[1]]" + strings.Repeat(")", 100) + " * [[1]]",
+		"[((-1)^0.5)..3] * [[1]]",
+		"sum([((-1)^0.5)..3])",
+		"transpose([]) + [[1]]",
+		"det(transpose([]))",
+	} {
+		body, err := json.Marshal(models.CalculateRequest{Expression: expression})
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/calculate", bytes.NewBuffer(body))
+		w := httptest.NewRecorder()
+		require.NotPanics(t, func() { router.ServeHTTP(w, req) }, "expression: %.40s", expression)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code, "expression: %.40s", expression)
+	}
+}
+
+func TestServer_HandleGetExpressionSteps(t *testing.T) {
+	_, router := setupTestServer(t)
+
+	body, err := json.Marshal(models.CalculateRequest{Expression: "2 * 3 + 4"})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/calculate", bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	var calcResp models.CalculateResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&calcResp))
+
+	time.Sleep(100 * time.Millisecond)
+
+	getSteps := func() []string {
+		var stepsResp models.StepsResponse
+		getJSON(t, router, "/api/v1/expressions/"+calcResp.ID+"/steps", &stepsResp)
+		assert.Equal(t, calcResp.ID, stepsResp.ID)
+		return stepsResp.Steps
+	}
+
+	assert.Equal(t, []string{"2*3+4"}, getSteps())
+
+	computeQueuedTasks(t, router)
+
+	assert.Equal(t, []string{"2*3+4", "6+4", "10"}, getSteps())
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/expressions/non-existent/steps", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestServer_SharedSubexpressions(t *testing.T) {
+	_, router := setupTestServer(t)
+
+	body, err := json.Marshal(models.CalculateRequest{Expression: "(1+2)*(2+1)/(1+2)"})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/calculate", bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	var calcResp models.CalculateResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&calcResp))
+
+	time.Sleep(100 * time.Millisecond)
+
+	operations := computeQueuedTasks(t, router)
+	assert.Equal(t, 1, operations["+"], "all three sums are one task")
+	assert.Equal(t, 1, operations["*"])
+	assert.Equal(t, 1, operations["/"])
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/expressions/"+calcResp.ID, nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var exprResp models.ExpressionResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&exprResp))
+	require.Equal(t, models.StatusComplete, exprResp.Expression.Status)
+	assert.Equal(t, 3.0, *exprResp.Expression.Result)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/expressions/"+calcResp.ID+"/steps", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var stepsResp models.StepsResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&stepsResp))
+	assert.Equal(t, []string{"(1+2)*(2+1)/(1+2)", "3*3/3", "9/3", "3"}, stepsResp.Steps)
+}
+
+func TestServer_ResultCache(t *testing.T) {
+	router := newTestRouter(t, &configs.ServerConfig{Port: "8080", ResultCacheSize: 100, ResultCacheTTLMS: 60000})
+
+	calculate(t, router, "2+3*4")
+	assert.Equal(t, map[string]int{"*": 1, "+": 1}, computeQueuedTasks(t, router))
+
+	id := calculate(t, router, "4*3+2")
+	assert.Empty(t, computeQueuedTasks(t, router), "both tasks are answered from the cache")
+
+	expr := getExpression(t, router, id)
+	require.Equal(t, models.StatusComplete, expr.Status)
+	assert.Equal(t, 14.0, *expr.Result)
+
+	var stats models.CacheStats
+	getJSON(t, router, "/internal/cache", &stats)
+	assert.Equal(t, models.CacheStats{Enabled: true, Size: 2, Capacity: 100, Hits: 2, Misses: 2}, stats)
+}
+
+func TestServer_SeriesSum(t *testing.T) {
+	_, router := setupTestServer(t)
+
+	body, err := json.Marshal(models.CalculateRequest{Expression: "sum(i, 1, 4, i*i)"})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/calculate", bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	var calcResp models.CalculateResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&calcResp))
+
+	time.Sleep(100 * time.Millisecond)
+
+	operations := computeQueuedTasks(t, router)
+	assert.Equal(t, 4, operations["*"], "each of the 4 terms is a separate task")
+	assert.Equal(t, 3, operations["+"], "4 terms are reduced by 3 additions")
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/expressions/"+calcResp.ID, nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var exprResp models.ExpressionResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&exprResp))
+	assert.Equal(t, models.StatusComplete, exprResp.Expression.Status)
+	require.NotNil(t, exprResp.Expression.Result)
+	assert.Equal(t, 30.0, *exprResp.Expression.Result)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/expressions/"+calcResp.ID+"/steps", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var stepsResp models.StepsResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&stepsResp))
+	require.NotEmpty(t, stepsResp.Steps)
+	assert.Equal(t, "1*1+2*2+(3*3+4*4)", stepsResp.Steps[0])
+	assert.Equal(t, "30", stepsResp.Steps[len(stepsResp.Steps)-1])
+}
+
+func TestServer_SeriesWithoutTasks(t *testing.T) {
+	_, router := setupTestServer(t)
+
+	body, err := json.Marshal(models.CalculateRequest{Expression: "prod(k, 3, 1, k)"})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/calculate", bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	var calcResp models.CalculateResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&calcResp))
+
+	time.Sleep(100 * time.Millisecond)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/expressions/"+calcResp.ID, nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var exprResp models.ExpressionResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&exprResp))
+	assert.Equal(t, models.StatusComplete, exprResp.Expression.Status)
+	require.NotNil(t, exprResp.Expression.Result)
+	assert.Equal(t, 1.0, *exprResp.Expression.Result, "an empty product is 1")
+}
+
+func TestServer_SeriesExpressionValidation(t *testing.T) {
+	_, router := setupTestServer(t)
+
+	for _, expression := range []string{
+		"integrate(x, 0, 1, x^2)",
+		"sum(i, 1, 100000, i)",
+		"sum(i, 1, 3, j)",
+		"sum(i, 1, 2, i) + 1",
+	} {
+		body, err := json.Marshal(models.CalculateRequest{Expression: expression})
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/calculate", bytes.NewBuffer(body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code, "expression: %s", expression)
+	}
+}
+
+func TestServer_SeriesExpressionLimits(t *testing.T) {
+	_, router := setupTestServer(t)
+
+	for _, tt := range []struct {
+		expression string
+		wantErr    string
+	}{
+		{
+			expression: "sum(i, 1, 3, " + strings.Repeat("(", 100) + "i" + strings.Repeat(")", 100) + ")",
+			wantErr:    common.ErrMaxDepthExceeded,
+		},
+		{
+			expression: "x" + strings.Repeat("+1", 60000),
+			wantErr:    common.ErrMaxLengthExceeded,
+		},
+	} {
+		var w *httptest.ResponseRecorder
+		require.NotPanics(t, func() {
+			w = postJSON(t, router, "/api/v1/calculate", models.CalculateRequest{Expression: tt.expression})
+		}, "expression: %.40s", tt.expression)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code, "expression: %.40s", tt.expression)
+		assert.Contains(t, w.Body.String(), tt.wantErr, "expression: %.40s", tt.expression)
+	}
+}
+
+func TestServer_NaturalMode(t *testing.T) {
+	_, router := setupTestServer(t)
+
+	body, err := json.Marshal(models.CalculateRequest{Expression: "два плюс три умножить на четыре", Mode: models.ModeNatural})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/calculate", bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	var calcResp models.CalculateResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&calcResp))
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/expressions/"+calcResp.ID, nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var exprResp models.ExpressionResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&exprResp))
+	assert.Equal(t, "2 + 3 * 4", exprResp.Expression.Expression)
+
+	// TranslateNatural отделяет лексемы пробелами, поэтому унарный минус
+	// распознается и после пробела.
+	w = postJSON(t, router, "/api/v1/calculate", models.CalculateRequest{Expression: "два умножить на минус три", Mode: models.ModeNatural})
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	for _, tt := range []models.CalculateRequest{
+		{Expression: "два плюс икс", Mode: models.ModeNatural},
+		{Expression: "два плюс два"},
+		{Expression: "2 + 2", Mode: "voice"},
+	} {
+		body, err := json.Marshal(tt)
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/calculate", bytes.NewBuffer(body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code, "expression: %s, mode: %s", tt.Expression, tt.Mode)
+	}
+}
+
+func TestServer_InputNotation(t *testing.T) {
+	_, router := setupTestServer(t)
+
+	tests := []struct {
+		expression string
+		notation   string
+		result     float64
+		firstStep  string
+	}{
+		{expression: "2 3 + 4 *", notation: models.NotationRPN, result: 20, firstStep: "(2+3)*4"},
+		{expression: "- 10 / 6 2", notation: models.NotationPrefix, result: 7, firstStep: "10-6/2"},
+	}
+
+	for _, tt := range tests {
+		body, err := json.Marshal(models.CalculateRequest{Expression: tt.expression, Notation: tt.notation})
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/calculate", bytes.NewBuffer(body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusCreated, w.Code)
+
+		var calcResp models.CalculateResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&calcResp))
+
+		time.Sleep(100 * time.Millisecond)
+		computeQueuedTasks(t, router)
+
+		req = httptest.NewRequest(http.MethodGet, "/api/v1/expressions/"+calcResp.ID, nil)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var exprResp models.ExpressionResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&exprResp))
+		assert.Equal(t, tt.notation, exprResp.Expression.Notation)
+		assert.Equal(t, models.StatusComplete, exprResp.Expression.Status, "expression: %s", tt.expression)
+		require.NotNil(t, exprResp.Expression.Result)
+		assert.Equal(t, tt.result, *exprResp.Expression.Result, "expression: %s", tt.expression)
+
+		req = httptest.NewRequest(http.MethodGet, "/api/v1/expressions/"+calcResp.ID+"/steps", nil)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var stepsResp models.StepsResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&stepsResp))
+		require.NotEmpty(t, stepsResp.Steps)
+		assert.Equal(t, tt.firstStep, stepsResp.Steps[0])
+	}
+}
+
+func TestServer_PlannerCorpus(t *testing.T) {
+	_, router := setupTestServer(t)
+
+	data, err := os.ReadFile(filepath.Join("testdata", "planner_corpus.txt"))
+	require.NoError(t, err)
+
+	ids := make(map[string]string)
+	for _, line := range strings.Split(string(data), "\n") {
+		expression := strings.TrimSpace(line)
+		if expression == "" || strings.HasPrefix(expression, "#") {
+			continue
+		}
+
+		body, err := json.Marshal(models.CalculateRequest{Expression: expression})
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/calculate", bytes.NewBuffer(body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusCreated, w.Code, "expression: %s", expression)
+
+		var calcResp models.CalculateResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&calcResp))
+		ids[expression] = calcResp.ID
+	}
+	require.NotEmpty(t, ids)
+
+	time.Sleep(200 * time.Millisecond)
+	computeQueuedTasks(t, router)
+
+	for expression, id := range ids {
+		expected, err := calculation.EvaluateExpression(expression)
+		require.NoError(t, err, "expression: %s", expression)
+
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/expressions/"+id, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var exprResp models.ExpressionResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&exprResp))
+		if !assert.Equal(t, models.StatusComplete, exprResp.Expression.Status, "expression: %s", expression) {
+			continue
+		}
+		require.NotNil(t, exprResp.Expression.Result, "expression: %s", expression)
+		assert.InDelta(t, expected, *exprResp.Expression.Result, 1e-9, "expression: %s", expression)
+	}
+}
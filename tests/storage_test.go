@@ -115,12 +115,11 @@ func TestStorage_SaveAndGetTask(t *testing.T) {
 	store := storage.New(logger)
 
 	task := &models.Task{
-		ID:               "task-1",
-		Arg1:             2.0,
-		Arg2:             3.0,
-		Operation:        "+",
-		ExpressionID:     "expr-1",
-		DependsOnTaskIDs: []string{},
+		ID:           "task-1",
+		Arg1:         models.Literal(2.0),
+		Arg2:         models.Literal(3.0),
+		Operation:    "+",
+		ExpressionID: "expr-1",
 	}
 
 	err := store.SaveTask(task)
@@ -133,7 +132,7 @@ func TestStorage_SaveAndGetTask(t *testing.T) {
 	assert.Equal(t, task.Arg2, saved.Arg2)
 	assert.Equal(t, task.Operation, saved.Operation)
 	assert.Equal(t, task.ExpressionID, saved.ExpressionID)
-	assert.Equal(t, task.DependsOnTaskIDs, saved.DependsOnTaskIDs)
+	assert.Equal(t, task.Dependencies(), saved.Dependencies())
 }
 
 func TestStorage_UpdateTaskResult(t *testing.T) {
@@ -144,12 +143,11 @@ func TestStorage_UpdateTaskResult(t *testing.T) {
 	assert.Error(t, err)
 
 	task := &models.Task{
-		ID:               "task-1",
-		Arg1:             2.0,
-		Arg2:             3.0,
-		Operation:        "+",
-		ExpressionID:     "expr-1",
-		DependsOnTaskIDs: []string{},
+		ID:           "task-1",
+		Arg1:         models.Literal(2.0),
+		Arg2:         models.Literal(3.0),
+		Operation:    "+",
+		ExpressionID: "expr-1",
 	}
 	require.NoError(t, store.SaveTask(task))
 
@@ -171,20 +169,18 @@ func TestStorage_GetNextTask(t *testing.T) {
 
 	tasks := []*models.Task{
 		{
-			ID:               "task-1",
-			Arg1:             2.0,
-			Arg2:             3.0,
-			Operation:        "+",
-			ExpressionID:     "expr-1",
-			DependsOnTaskIDs: []string{},
+			ID:           "task-1",
+			Arg1:         models.Literal(2.0),
+			Arg2:         models.Literal(3.0),
+			Operation:    "+",
+			ExpressionID: "expr-1",
 		},
 		{
-			ID:               "task-2",
-			Arg1:             4.0,
-			Arg2:             5.0,
-			Operation:        "*",
-			ExpressionID:     "expr-1",
-			DependsOnTaskIDs: []string{},
+			ID:           "task-2",
+			Arg1:         models.Literal(4.0),
+			Arg2:         models.Literal(5.0),
+			Operation:    "*",
+			ExpressionID: "expr-1",
 		},
 	}
 
@@ -203,6 +199,475 @@ func TestStorage_GetNextTask(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestStorage_DependentTaskQueuedAfterDependencies(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	store := storage.New(logger)
+
+	// (2 - 2) * (1 + 3): произведение ждет обе задачи, первая дает ноль.
+	tasks := []*models.Task{
+		{ID: "sub", ExpressionID: "expr-1", Operation: "-", Arg1: models.Literal(2), Arg2: models.Literal(2)},
+		{ID: "add", ExpressionID: "expr-1", Operation: "+", Arg1: models.Literal(1), Arg2: models.Literal(3)},
+		{ID: "mul", ExpressionID: "expr-1", Operation: "*", Arg1: models.Ref("sub"), Arg2: models.Ref("add")},
+	}
+	for _, task := range tasks {
+		require.NoError(t, store.SaveTask(task))
+	}
+
+	for _, id := range []string{"sub", "add"} {
+		task, err := store.GetNextTask()
+		require.NoError(t, err)
+		assert.Equal(t, id, task.ID)
+	}
+	_, err := store.GetNextTask()
+	assert.Error(t, err, "the product must wait for its dependencies")
+
+	require.NoError(t, store.UpdateTaskResult("sub", 0))
+	_, err = store.GetNextTask()
+	assert.Error(t, err, "the product still waits for the addition")
+
+	require.NoError(t, store.UpdateTaskResult("add", 4))
+	require.NoError(t, store.UpdateTaskResult("add", 4))
+	task, err := store.GetNextTask()
+	require.NoError(t, err)
+	assert.Equal(t, "mul", task.ID)
+	assert.Equal(t, 0.0, *task.Arg1.Value)
+	assert.Equal(t, 4.0, *task.Arg2.Value)
+
+	_, err = store.GetNextTask()
+	assert.Error(t, err, "a repeated result must not queue the product twice")
+}
+
+func TestStorage_ResultCache(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	store := storage.New(logger, storage.WithResultCache(10, time.Minute))
+
+	require.NoError(t, store.SaveTask(&models.Task{ID: "a", ExpressionID: "expr-1", Operation: "+",
+		Arg1: models.Literal(2), Arg2: models.Literal(3)}))
+	task, err := store.GetNextTask()
+	require.NoError(t, err)
+	require.NoError(t, store.UpdateTaskResult(task.ID, 5))
+
+	// 3 + 2 из другого выражения берется из кэша, а зависящая от него задача
+	// сразу попадает в очередь с подставленным результатом.
+	require.NoError(t, store.SaveTask(&models.Task{ID: "b", ExpressionID: "expr-2", Operation: "+",
+		Arg1: models.Literal(3), Arg2: models.Literal(2)}))
+	require.NoError(t, store.SaveTask(&models.Task{ID: "c", ExpressionID: "expr-2", Operation: "-",
+		Arg1: models.Ref("b"), Arg2: models.Literal(1)}))
+
+	result, err := store.GetTaskResult("b")
+	require.NoError(t, err)
+	assert.Equal(t, 5.0, result)
+
+	task, err = store.GetNextTask()
+	require.NoError(t, err)
+	assert.Equal(t, "c", task.ID)
+	assert.Equal(t, 5.0, *task.Arg1.Value)
+
+	_, err = store.GetNextTask()
+	assert.Error(t, err)
+
+	assert.Equal(t, models.CacheStats{Enabled: true, Size: 1, Capacity: 10, Hits: 1, Misses: 2}, store.CacheStats())
+}
+
+func TestStorage_ResultCacheLimits(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+
+	compute := func(store *storage.Storage, id string, arg float64) bool {
+		require.NoError(t, store.SaveTask(&models.Task{ID: id, ExpressionID: "expr-" + id, Operation: "*",
+			Arg1: models.Literal(arg), Arg2: models.Literal(arg)}))
+		task, err := store.GetNextTask()
+		if err != nil {
+			return false
+		}
+		require.NoError(t, store.UpdateTaskResult(task.ID, arg*arg))
+		return true
+	}
+
+	t.Run("least recently used entry is evicted", func(t *testing.T) {
+		store := storage.New(logger, storage.WithResultCache(1, time.Minute))
+		assert.True(t, compute(store, "a", 2))
+		assert.True(t, compute(store, "b", 3))
+		assert.True(t, compute(store, "c", 2), "2*2 was evicted by 3*3")
+		assert.Equal(t, 1, store.CacheStats().Size)
+	})
+
+	t.Run("expired entry is a miss", func(t *testing.T) {
+		clock := newFakeClock()
+		store := storage.New(logger, storage.WithResultCache(10, time.Millisecond), storage.WithClock(clock.Now))
+		assert.True(t, compute(store, "a", 2))
+		clock.Advance(5 * time.Millisecond)
+		assert.True(t, compute(store, "b", 2), "2*2 has expired")
+		assert.Equal(t, uint64(0), store.CacheStats().Hits)
+	})
+
+	t.Run("zero size disables the cache", func(t *testing.T) {
+		store := storage.New(logger, storage.WithResultCache(0, time.Minute))
+		assert.True(t, compute(store, "a", 2))
+		assert.True(t, compute(store, "b", 2))
+		assert.Equal(t, models.CacheStats{}, store.CacheStats())
+	})
+}
+
+func TestStorage_TaskLease(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	clock := newFakeClock()
+	store := storage.New(logger, storage.WithLeaseTimeout(50*time.Millisecond), storage.WithClock(clock.Now))
+
+	require.NoError(t, store.SaveTask(&models.Task{ID: "task-1", ExpressionID: "expr-1", Operation: "+",
+		Arg1: models.Literal(2), Arg2: models.Literal(3)}))
+
+	first, err := store.GetNextTask()
+	require.NoError(t, err)
+	assert.NotEmpty(t, first.LeaseToken)
+	assert.Equal(t, int64(50), first.LeaseTimeoutMS)
+
+	// Продленная аренда не дает выдать задачу другому агенту.
+	for i := 0; i < 3; i++ {
+		clock.Advance(30 * time.Millisecond)
+		require.NoError(t, store.ExtendLease(first.ID, first.LeaseToken))
+	}
+	_, err = store.GetNextTask()
+	assert.Error(t, err, "the leased task must stay invisible")
+
+	assert.ErrorIs(t, store.ExtendLease(first.ID, "wrong-token"), storage.ErrLeaseNotHeld)
+
+	// Истекшая аренда возвращает задачу в очередь с новым токеном.
+	clock.Advance(50 * time.Millisecond)
+	_, err = store.GetNextTask()
+	assert.Error(t, err, "the lease has not expired yet")
+
+	clock.Advance(time.Millisecond)
+	second, err := store.GetNextTask()
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, second.ID)
+	assert.NotEqual(t, first.LeaseToken, second.LeaseToken)
+
+	assert.ErrorIs(t, store.CompleteTask(first.ID, first.LeaseToken, 5), storage.ErrLeaseNotHeld)
+	require.NoError(t, store.CompleteTask(second.ID, second.LeaseToken, 5))
+	assert.Error(t, store.CompleteTask("non-existent", "", 5))
+
+	result, err := store.GetTaskResult(first.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 5.0, result)
+
+	clock.Advance(time.Minute)
+	_, err = store.GetNextTask()
+	assert.Error(t, err, "a completed task is never requeued")
+}
+
+func TestStorage_TaskRetries(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	clock := newFakeClock()
+	store := storage.New(logger,
+		storage.WithLeaseTimeout(20*time.Millisecond),
+		storage.WithRetryPolicy(2, 60*time.Millisecond),
+		storage.WithClock(clock.Now))
+
+	require.NoError(t, store.SaveExpression(&models.Expression{ID: "expr-1", Expression: "2+3", Status: models.StatusPending}))
+	require.NoError(t, store.UpdateExpressionStatus("expr-1", models.StatusProgress))
+	require.NoError(t, store.SaveTask(&models.Task{ID: "task-1", ExpressionID: "expr-1", Operation: "+",
+		Arg1: models.Literal(2), Arg2: models.Literal(3)}))
+
+	task, err := store.GetNextTask()
+	require.NoError(t, err)
+	assert.Equal(t, 1, task.Attempts)
+
+	// Аренда истекла: задача вернется в очередь только после задержки.
+	clock.Advance(21 * time.Millisecond)
+	_, err = store.GetNextTask()
+	assert.Error(t, err, "the retry waits for its backoff")
+
+	clock.Advance(59 * time.Millisecond)
+	_, err = store.GetNextTask()
+	assert.Error(t, err, "the retry waits for its backoff")
+
+	clock.Advance(time.Millisecond)
+	task, err = store.GetNextTask()
+	require.NoError(t, err)
+	assert.Equal(t, 2, task.Attempts)
+
+	// Вторая попытка тоже не удалась: задача попадает в недоставленные.
+	clock.Advance(21 * time.Millisecond)
+	_, err = store.GetNextTask()
+	assert.Error(t, err)
+
+	letters := store.DeadLetters()
+	require.Len(t, letters, 1)
+	assert.Equal(t, "task-1", letters[0].Task.ID)
+	assert.Equal(t, `operation "+" failed after 2 attempts: task lease expired`, letters[0].Reason)
+
+	expr, err := store.GetExpression("expr-1")
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusError, expr.Status)
+	assert.Equal(t, letters[0].Reason, expr.Error)
+
+	require.NoError(t, store.RequeueDeadLetter("task-1"))
+	assert.Error(t, store.RequeueDeadLetter("task-1"))
+	assert.Empty(t, store.DeadLetters())
+
+	expr, err = store.GetExpression("expr-1")
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusProgress, expr.Status)
+	assert.Empty(t, expr.Error)
+
+	task, err = store.GetNextTask()
+	require.NoError(t, err)
+	assert.Equal(t, 1, task.Attempts)
+	require.NoError(t, store.CompleteTask(task.ID, task.LeaseToken, 5))
+}
+
+func TestStorage_DeadLetterSiblings(t *testing.T) {
+	clock := newFakeClock()
+	store := storage.New(zap.NewNop(),
+		storage.WithLeaseTimeout(20*time.Millisecond),
+		storage.WithRetryPolicy(1, 0),
+		storage.WithClock(clock.Now))
+
+	require.NoError(t, store.SaveExpression(&models.Expression{ID: "expr-1", Expression: "(2+3)*(4+5)", Status: models.StatusPending}))
+	require.NoError(t, store.UpdateExpressionStatus("expr-1", models.StatusProgress))
+	require.NoError(t, store.SaveTask(&models.Task{ID: "task-1", ExpressionID: "expr-1", Operation: "+",
+		Arg1: models.Literal(2), Arg2: models.Literal(3)}))
+	require.NoError(t, store.SaveTask(&models.Task{ID: "task-2", ExpressionID: "expr-1", Operation: "+",
+		Arg1: models.Literal(4), Arg2: models.Literal(5)}))
+	require.NoError(t, store.SaveTask(&models.Task{ID: "task-3", ExpressionID: "expr-1", Operation: "*",
+		Arg1: models.Ref("task-1"), Arg2: models.Ref("task-2")}))
+
+	first, err := store.GetNextTask()
+	require.NoError(t, err)
+	second, err := store.GetNextTask()
+	require.NoError(t, err)
+
+	// Обе аренды истекли, но первая же недоставленная задача отменяет остальные задачи
+	// выражения: вторая в недоставленные не попадает, а ее результат отклоняется.
+	clock.Advance(21 * time.Millisecond)
+	_, err = store.GetNextTask()
+	assert.Error(t, err)
+
+	letters := store.DeadLetters()
+	require.Len(t, letters, 1)
+	expr, err := store.GetExpression("expr-1")
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusError, expr.Status)
+	for _, task := range []*models.Task{first, second} {
+		assert.ErrorIs(t, store.CompleteTask(task.ID, task.LeaseToken, 1), storage.ErrLeaseNotHeld)
+	}
+	assert.Error(t, store.UpdateExpressionStatus("expr-1", models.StatusComplete))
+
+	// Повторная выдача возвращает в работу все невыполненные задачи выражения.
+	require.NoError(t, store.RequeueDeadLetter(letters[0].Task.ID))
+	assert.Empty(t, store.DeadLetters())
+	expr, err = store.GetExpression("expr-1")
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusProgress, expr.Status)
+
+	results := map[string]float64{"task-1": 5, "task-2": 9, "task-3": 45}
+	for i := 0; i < 3; i++ {
+		task, err := store.GetNextTask()
+		require.NoError(t, err)
+		require.NoError(t, store.CompleteTask(task.ID, task.LeaseToken, results[task.ID]))
+	}
+	expr, err = store.GetExpression("expr-1")
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusComplete, expr.Status)
+}
+
+func TestStorage_CancelExpression(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	store := storage.New(logger)
+
+	_, err := store.CancelExpression("non-existent")
+	assert.Error(t, err)
+
+	require.NoError(t, store.SaveExpression(&models.Expression{ID: "expr-1", Expression: "(2+3)*4", Status: models.StatusPending}))
+	require.NoError(t, store.UpdateExpressionStatus("expr-1", models.StatusProgress))
+	require.NoError(t, store.SaveTask(&models.Task{ID: "task-1", ExpressionID: "expr-1", Operation: "+",
+		Arg1: models.Literal(2), Arg2: models.Literal(3)}))
+	require.NoError(t, store.SaveTask(&models.Task{ID: "task-2", ExpressionID: "expr-1", Operation: "*",
+		Arg1: models.Ref("task-1"), Arg2: models.Literal(4)}))
+
+	task, err := store.GetNextTask()
+	require.NoError(t, err)
+
+	expr, err := store.CancelExpression("expr-1")
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusCancelled, expr.Status)
+
+	// Результат агента, пришедший после отмены, отклоняется, и зависимая задача
+	// в очередь не попадает.
+	assert.ErrorIs(t, store.CompleteTask(task.ID, task.LeaseToken, 5), storage.ErrLeaseNotHeld)
+	_, err = store.GetNextTask()
+	assert.Error(t, err)
+
+	// Ошибка и результат не меняют статус отмененного выражения.
+	require.NoError(t, store.UpdateExpressionError("expr-1", "late error"))
+	require.NoError(t, store.UpdateExpressionResult("expr-1", 20))
+	saved, err := store.GetExpression("expr-1")
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusCancelled, saved.Status)
+	assert.Nil(t, saved.Result)
+	assert.Error(t, store.UpdateExpressionStatus("expr-1", models.StatusProgress))
+
+	_, err = store.CancelExpression("expr-1")
+	assert.ErrorIs(t, err, storage.ErrExpressionFinished)
+
+	// Задачи, сохраненные после отмены, тоже не попадают в очередь.
+	require.NoError(t, store.SaveTask(&models.Task{ID: "task-3", ExpressionID: "expr-1", Operation: "-",
+		Arg1: models.Literal(1), Arg2: models.Literal(1)}))
+	_, err = store.GetNextTask()
+	assert.Error(t, err)
+}
+
+func TestStorage_TimeoutExpression(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	store := storage.New(logger)
+
+	assert.Error(t, store.TimeoutExpression("non-existent", "timed out"))
+
+	require.NoError(t, store.SaveExpression(&models.Expression{ID: "expr-1", Expression: "(2+3)*4", Status: models.StatusPending}))
+	require.NoError(t, store.UpdateExpressionStatus("expr-1", models.StatusProgress))
+	require.NoError(t, store.SaveTask(&models.Task{ID: "task-1", ExpressionID: "expr-1", Operation: "+",
+		Arg1: models.Literal(2), Arg2: models.Literal(3)}))
+	require.NoError(t, store.SaveTask(&models.Task{ID: "task-2", ExpressionID: "expr-1", Operation: "*",
+		Arg1: models.Ref("task-1"), Arg2: models.Literal(4)}))
+
+	task, err := store.GetNextTask()
+	require.NoError(t, err)
+	require.NoError(t, store.CompleteTask(task.ID, task.LeaseToken, 5))
+	task, err = store.GetNextTask()
+	require.NoError(t, err)
+
+	require.NoError(t, store.TimeoutExpression("expr-1", "timed out"))
+
+	expr, err := store.GetExpression("expr-1")
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusTimeout, expr.Status)
+	assert.Equal(t, "timed out", expr.Error)
+	assert.Equal(t, &models.Progress{CompletedTasks: 1, TotalTasks: 2}, expr.Progress)
+
+	assert.ErrorIs(t, store.CompleteTask(task.ID, task.LeaseToken, 20), storage.ErrLeaseNotHeld)
+	require.NoError(t, store.UpdateExpressionResult("expr-1", 20))
+	expr, err = store.GetExpression("expr-1")
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusTimeout, expr.Status)
+
+	assert.ErrorIs(t, store.TimeoutExpression("expr-1", "timed out"), storage.ErrExpressionFinished)
+	_, err = store.CancelExpression("expr-1")
+	assert.ErrorIs(t, err, storage.ErrExpressionFinished)
+}
+
+func TestStorage_ExpireAfter(t *testing.T) {
+	clock := newFakeClock()
+	store := storage.New(zap.NewNop(),
+		storage.WithLeaseTimeout(20*time.Millisecond),
+		storage.WithRetryPolicy(1, 0),
+		storage.WithClock(clock.Now))
+
+	status := func(id string) models.ExpressionStatus {
+		expr, err := store.GetExpression(id)
+		require.NoError(t, err)
+		return expr.Status
+	}
+
+	require.NoError(t, store.SaveExpression(&models.Expression{ID: "slow", Status: models.StatusProgress, TimeoutMS: 20}))
+	store.ExpireAfter("slow", 20)
+	require.Eventually(t, func() bool { return status("slow") == models.StatusTimeout }, time.Second, 5*time.Millisecond)
+	expr, err := store.GetExpression("slow")
+	require.NoError(t, err)
+	assert.Equal(t, "expression timed out after 20 ms", expr.Error)
+
+	// Вычисленное выражение останавливает таймер и больше не прерывается.
+	require.NoError(t, store.SaveExpression(&models.Expression{ID: "fast", Status: models.StatusProgress, TimeoutMS: 20}))
+	store.ExpireAfter("fast", 20)
+	require.NoError(t, store.UpdateExpressionResult("fast", 1))
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, models.StatusComplete, status("fast"))
+
+	// Ошибка останавливает таймер, а повторная выдача недоставленной задачи
+	// запускает его снова до первоначального срока.
+	require.NoError(t, store.SaveExpression(&models.Expression{ID: "failed", Status: models.StatusProgress, TimeoutMS: 100}))
+	store.ExpireAfter("failed", 100)
+	require.NoError(t, store.SaveTask(&models.Task{ID: "task-1", ExpressionID: "failed", Operation: "+",
+		Arg1: models.Literal(1), Arg2: models.Literal(1)}))
+	_, err = store.GetNextTask()
+	require.NoError(t, err)
+	clock.Advance(21 * time.Millisecond)
+	_, err = store.GetNextTask()
+	require.Error(t, err)
+	require.Equal(t, models.StatusError, status("failed"))
+
+	require.NoError(t, store.RequeueDeadLetter("task-1"))
+	require.Equal(t, models.StatusProgress, status("failed"))
+	require.Eventually(t, func() bool { return status("failed") == models.StatusTimeout }, time.Second, 5*time.Millisecond)
+}
+
+func TestStorage_TaskScheduling(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	store := storage.New(logger)
+
+	for _, expr := range []*models.Expression{
+		{ID: "batch", Status: models.StatusProgress, Priority: -1},
+		{ID: "expr-a", Status: models.StatusProgress},
+		{ID: "expr-b", Status: models.StatusProgress},
+		{ID: "urgent", Status: models.StatusProgress, Priority: 5},
+		{ID: "cancelled", Status: models.StatusProgress},
+	} {
+		require.NoError(t, store.SaveExpression(expr))
+	}
+	for _, task := range []struct{ id, exprID string }{
+		{"batch-1", "batch"},
+		{"a-1", "expr-a"},
+		{"a-2", "expr-a"},
+		{"a-3", "expr-a"},
+		{"cancelled-1", "cancelled"},
+		{"b-1", "expr-b"},
+		{"b-2", "expr-b"},
+		{"urgent-1", "urgent"},
+	} {
+		require.NoError(t, store.SaveTask(&models.Task{ID: task.id, ExpressionID: task.exprID, Operation: "+",
+			Arg1: models.Literal(1), Arg2: models.Literal(2)}))
+	}
+	_, err := store.CancelExpression("cancelled")
+	require.NoError(t, err)
+
+	// Срочное выражение - первым, выражения одного приоритета - по очереди,
+	// фоновое - последним.
+	var order []string
+	for {
+		task, err := store.GetNextTask()
+		if err != nil {
+			break
+		}
+		order = append(order, task.ID)
+	}
+	assert.Equal(t, []string{"urgent-1", "a-1", "b-1", "a-2", "b-2", "a-3", "batch-1"}, order)
+}
+
+func TestStorage_CriticalPathFirst(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	store := storage.New(logger)
+
+	for _, task := range []*models.Task{
+		{ID: "short", CriticalPathMS: 100},
+		{ID: "long", CriticalPathMS: 500},
+		{ID: "medium", CriticalPathMS: 300},
+		{ID: "long-later", CriticalPathMS: 500},
+	} {
+		task.ExpressionID, task.Operation = "expr-1", "+"
+		task.Arg1, task.Arg2 = models.Literal(1), models.Literal(2)
+		require.NoError(t, store.SaveTask(task))
+	}
+
+	var order []string
+	for {
+		task, err := store.GetNextTask()
+		if err != nil {
+			break
+		}
+		order = append(order, task.ID)
+	}
+	assert.Equal(t, []string{"long", "long-later", "medium", "short"}, order)
+}
+
 func TestStorage_UpdateExpressionStatus(t *testing.T) {
 	logger, _ := zap.NewDevelopment()
 	store := storage.New(logger)
@@ -250,6 +715,26 @@ func TestStorage_UpdateExpressionResult(t *testing.T) {
 	assert.Equal(t, models.StatusComplete, saved.Status)
 }
 
+func TestStorage_UpdateExpressionResult_Formatted(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	store := storage.New(logger)
+
+	expr := &models.Expression{
+		ID:         "test-id-1",
+		Expression: "0.1+0.2",
+		Status:     models.StatusProgress,
+		Format:     &models.FormatOptions{Digits: 2, Rounding: "half-up", Notation: "plain"},
+	}
+	require.NoError(t, store.SaveExpression(expr))
+	require.NoError(t, store.UpdateExpressionResult(expr.ID, 0.1+0.2))
+
+	saved, err := store.GetExpression(expr.ID)
+	require.NoError(t, err)
+	require.NotNil(t, saved.Result)
+	assert.Equal(t, 0.1+0.2, *saved.Result)
+	assert.Equal(t, "0.30", saved.Formatted)
+}
+
 func TestStorage_UpdateExpressionError(t *testing.T) {
 	logger, _ := zap.NewDevelopment()
 	store := storage.New(logger)
@@ -314,35 +799,32 @@ func TestStorage_SaveTask_Validation(t *testing.T) {
 		{
 			name: "valid task",
 			task: &models.Task{
-				ID:               "task-1",
-				Arg1:             2.0,
-				Arg2:             3.0,
-				Operation:        "+",
-				ExpressionID:     "expr-1",
-				DependsOnTaskIDs: []string{},
+				ID:           "task-1",
+				Arg1:         models.Literal(2.0),
+				Arg2:         models.Literal(3.0),
+				Operation:    "+",
+				ExpressionID: "expr-1",
 			},
 			wantErr: false,
 		},
 		{
 			name: "empty id",
 			task: &models.Task{
-				Arg1:             2.0,
-				Arg2:             3.0,
-				Operation:        "+",
-				ExpressionID:     "expr-1",
-				DependsOnTaskIDs: []string{},
+				Arg1:         models.Literal(2.0),
+				Arg2:         models.Literal(3.0),
+				Operation:    "+",
+				ExpressionID: "expr-1",
 			},
 			wantErr: true,
 		},
 		{
 			name: "invalid operation",
 			task: &models.Task{
-				ID:               "task-2",
-				Arg1:             2.0,
-				Arg2:             3.0,
-				Operation:        "%",
-				ExpressionID:     "expr-1",
-				DependsOnTaskIDs: []string{},
+				ID:           "task-2",
+				Arg1:         models.Literal(2.0),
+				Arg2:         models.Literal(3.0),
+				Operation:    "%",
+				ExpressionID: "expr-1",
 			},
 			wantErr: false, // Assuming % is a valid operation for testing
 		},
@@ -363,7 +845,7 @@ func TestStorage_SaveTask_Validation(t *testing.T) {
 			require.NoError(t, err)
 			assert.Equal(t, tt.task.Operation, saved.Operation)
 			assert.Equal(t, tt.task.ExpressionID, saved.ExpressionID)
-			assert.Equal(t, tt.task.DependsOnTaskIDs, saved.DependsOnTaskIDs)
+			assert.Equal(t, tt.task.Dependencies(), saved.Dependencies())
 		})
 	}
 }
@@ -374,20 +856,18 @@ func TestStorage_TaskQueue_Behavior(t *testing.T) {
 
 	tasks := []*models.Task{
 		{
-			ID:               "task-1",
-			Arg1:             2.0,
-			Arg2:             3.0,
-			Operation:        "+",
-			ExpressionID:     "expr-1",
-			DependsOnTaskIDs: []string{},
+			ID:           "task-1",
+			Arg1:         models.Literal(2.0),
+			Arg2:         models.Literal(3.0),
+			Operation:    "+",
+			ExpressionID: "expr-1",
 		},
 		{
-			ID:               "task-2",
-			Arg1:             4.0,
-			Arg2:             5.0,
-			Operation:        "*",
-			ExpressionID:     "expr-1",
-			DependsOnTaskIDs: []string{},
+			ID:           "task-2",
+			Arg1:         models.Literal(4.0),
+			Arg2:         models.Literal(5.0),
+			Operation:    "*",
+			ExpressionID: "expr-1",
 		},
 	}
 
@@ -460,12 +940,11 @@ func TestStorage_ConcurrentTaskProcessing(t *testing.T) {
 
 	for i := 0; i < workers*tasksPerWorker; i++ {
 		task := &models.Task{
-			ID:               fmt.Sprintf("task-%d", i),
-			Arg1:             float64(i),
-			Arg2:             float64(i + 1),
-			Operation:        "+",
-			ExpressionID:     "expr-1",
-			DependsOnTaskIDs: []string{},
+			ID:           fmt.Sprintf("task-%d", i),
+			Arg1:         models.Literal(float64(i)),
+			Arg2:         models.Literal(float64(i + 1)),
+			Operation:    "+",
+			ExpressionID: "expr-1",
 		}
 		require.NoError(t, store.SaveTask(task))
 	}
@@ -482,7 +961,7 @@ func TestStorage_ConcurrentTaskProcessing(t *testing.T) {
 				}
 
 				time.Sleep(time.Millisecond) // Simulate processing
-				result := task.Arg1 + task.Arg2
+				result := *task.Arg1.Value + *task.Arg2.Value
 				require.NoError(t, store.UpdateTaskResult(task.ID, result))
 
 				mu.Lock()
@@ -5,9 +5,11 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/flexer2006/y.lms-sprint2-calculator/common"
 	"github.com/flexer2006/y.lms-sprint2-calculator/configs"
 	"github.com/flexer2006/y.lms-sprint2-calculator/internal/logger"
 	"github.com/flexer2006/y.lms-sprint2-calculator/internal/server/models"
@@ -34,87 +36,206 @@ func TestAgent_Calculate(t *testing.T) {
 		name        string
 		task        *models.Task
 		expected    float64
-		expectError bool
+		expectError string
 	}{
 		{
 			name: "Addition",
 			task: &models.Task{
-				ID:               "1",
-				Operation:        "+",
-				Arg1:             10,
-				Arg2:             5,
-				DependsOnTaskIDs: []string{}, // Добавлено для соответствия новой структуре, но не используется в Calculate
+				ID:        "1",
+				Operation: "+",
+				Arg1:      models.Literal(10),
+				Arg2:      models.Literal(5),
 			},
-			expected:    15,
-			expectError: false,
+			expected: 15,
 		},
 		{
 			name: "Subtraction",
 			task: &models.Task{
-				ID:               "2",
-				Operation:        "-",
-				Arg1:             10,
-				Arg2:             5,
-				DependsOnTaskIDs: []string{},
+				ID:        "2",
+				Operation: "-",
+				Arg1:      models.Literal(10),
+				Arg2:      models.Literal(5),
 			},
-			expected:    5,
-			expectError: false,
+			expected: 5,
 		},
 		{
 			name: "Multiplication",
 			task: &models.Task{
-				ID:               "3",
-				Operation:        "*",
-				Arg1:             10,
-				Arg2:             5,
-				DependsOnTaskIDs: []string{},
+				ID:        "3",
+				Operation: "*",
+				Arg1:      models.Literal(10),
+				Arg2:      models.Literal(5),
 			},
-			expected:    50,
-			expectError: false,
+			expected: 50,
 		},
 		{
 			name: "Division",
 			task: &models.Task{
-				ID:               "4",
-				Operation:        "/",
-				Arg1:             10,
-				Arg2:             5,
-				DependsOnTaskIDs: []string{},
+				ID:        "4",
+				Operation: "/",
+				Arg1:      models.Literal(10),
+				Arg2:      models.Literal(5),
 			},
-			expected:    2,
-			expectError: false,
+			expected: 2,
 		},
 		{
 			name: "Division by zero",
 			task: &models.Task{
-				ID:               "5",
-				Operation:        "/",
-				Arg1:             10,
-				Arg2:             0,
-				DependsOnTaskIDs: []string{},
+				ID:        "5",
+				Operation: "/",
+				Arg1:      models.Literal(10),
+				Arg2:      models.Literal(0),
 			},
-			expectError: true,
+			expectError: common.ErrDivisionByZero,
+		},
+		{
+			name: "Power",
+			task: &models.Task{
+				ID:        "6",
+				Operation: "^",
+				Arg1:      models.Literal(2),
+				Arg2:      models.Literal(10),
+			},
+			expected: 1024,
+		},
+		{
+			name: "Modulo",
+			task: &models.Task{
+				ID:        "7",
+				Operation: "%",
+				Arg1:      models.Literal(-10),
+				Arg2:      models.Literal(3),
+			},
+			expected: -1,
+		},
+		{
+			name: "Modulo by zero",
+			task: &models.Task{
+				ID:        "8",
+				Operation: "%",
+				Arg1:      models.Literal(10),
+				Arg2:      models.Literal(0),
+			},
+			expectError: common.ErrModuloByZero,
+		},
+		{
+			name: "Modulo of non-integers",
+			task: &models.Task{
+				ID:        "9",
+				Operation: "%",
+				Arg1:      models.Literal(10.5),
+				Arg2:      models.Literal(3),
+			},
+			expectError: common.ErrInvalidModulo,
+		},
+		{
+			name: "Power of a negative number to a fraction",
+			task: &models.Task{
+				ID:        "17",
+				Operation: "^",
+				Arg1:      models.Literal(-1),
+				Arg2:      models.Literal(0.5),
+			},
+			expectError: common.ErrNonFiniteResult,
+		},
+		{
+			name: "Power overflow",
+			task: &models.Task{
+				ID:        "18",
+				Operation: "^",
+				Arg1:      models.Literal(2),
+				Arg2:      models.Literal(2000),
+			},
+			expectError: common.ErrNonFiniteResult,
+		},
+		{
+			name: "Fragment overflow",
+			task: &models.Task{
+				ID:        "19",
+				Operation: "*",
+				Fragment:  []string{"1e308", "10", "*"},
+			},
+			expectError: common.ErrNonFiniteResult,
 		},
 		{
 			name: "Unknown operation",
 			task: &models.Task{
-				ID:               "6",
-				Operation:        "%",
-				Arg1:             10,
-				Arg2:             5,
-				DependsOnTaskIDs: []string{},
+				ID:        "10",
+				Operation: "&",
+				Arg1:      models.Literal(10),
+				Arg2:      models.Literal(5),
+			},
+			expectError: common.ErrUnexpectedToken,
+		},
+		{
+			name: "Unresolved operand",
+			task: &models.Task{
+				ID:        "11",
+				Operation: "+",
+				Arg1:      models.Literal(10),
+				Arg2:      models.Ref("1"),
+			},
+			expectError: common.ErrUnresolvedOperand,
+		},
+		{
+			name: "Fragment",
+			task: &models.Task{
+				ID:        "12",
+				Operation: "*",
+				Arg1:      models.Literal(3),
+				Arg2:      models.Literal(4),
+				Fragment:  []string{models.FragmentArg1, "2", "+", models.FragmentArg2, "*"},
 			},
-			expectError: true,
+			expected: 20,
+		},
+		{
+			name: "Fragment without task arguments",
+			task: &models.Task{
+				ID:        "13",
+				Operation: "-",
+				Fragment:  []string{"1", "2", "+", "3", "4", "+", "*", "-5", "-"},
+			},
+			expected: 26,
+		},
+		{
+			name: "Fragment division by zero",
+			task: &models.Task{
+				ID:        "14",
+				Operation: "/",
+				Arg1:      models.Literal(2),
+				Fragment:  []string{"1", models.FragmentArg1, "2", "-", "/"},
+			},
+			expectError: common.ErrDivisionByZero,
+		},
+		{
+			name: "Fragment with unresolved argument",
+			task: &models.Task{
+				ID:        "15",
+				Operation: "+",
+				Arg1:      models.Ref("1"),
+				Fragment:  []string{models.FragmentArg1, "1", "1", "+", "+"},
+			},
+			expectError: common.ErrUnresolvedOperand,
+		},
+		{
+			name: "Invalid fragment",
+			task: &models.Task{
+				ID:        "16",
+				Operation: "+",
+				Fragment:  []string{"1", "+", "2"},
+			},
+			expectError: common.ErrInvalidFragment,
 		},
 	}
 
 	for _, tt := range tests {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
-			if tt.expectError {
-				assert.Panics(t, func() { agent.Calculate(tt.task) }, "Expected panic but got none")
+			result, err := agent.Calculate(tt.task)
+			if tt.expectError != "" {
+				assert.EqualError(t, err, tt.expectError)
 			} else {
-				result := agent.Calculate(tt.task)
+				require.NoError(t, err)
 				assert.Equal(t, tt.expected, result)
 			}
 		})
@@ -125,7 +246,20 @@ func TestAgent_Integration(t *testing.T) {
 	taskCh := make(chan models.Task, 1)
 	resultCh := make(chan models.TaskResult, 1)
 
+	var extensions atomic.Int32
+
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/internal/task/test-task/lease" {
+			var req models.LeaseRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.LeaseToken != "lease-1" {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+			extensions.Add(1)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
 		switch r.Method {
 		case http.MethodGet:
 			select {
@@ -163,9 +297,11 @@ func TestAgent_Integration(t *testing.T) {
 	})
 	require.NoError(t, err)
 
+	// Время из задачи важнее конфигурации агента: иначе результат не успеет прийти.
 	agent := worker.New(&configs.WorkerConfig{
 		ComputingPower:  1,
 		OrchestratorURL: server.URL,
+		AdditionTimeMS:  60000,
 	}, log)
 
 	errCh := make(chan error, 1)
@@ -191,11 +327,14 @@ func TestAgent_Integration(t *testing.T) {
 	}()
 
 	task := models.Task{
-		ID:               "test-task",
-		Operation:        "+",
-		Arg1:             10,
-		Arg2:             5,
-		DependsOnTaskIDs: []string{}, // Добавлено для соответствия новой структуре
+		ID:            "test-task",
+		Operation:     "+",
+		Arg1:          models.Literal(10),
+		Arg2:          models.Literal(5),
+		OperationTime: 100,
+		// Аренда короче операции: агент должен продлевать ее, пока вычисляет.
+		LeaseToken:     "lease-1",
+		LeaseTimeoutMS: 40,
 	}
 
 	select {
@@ -208,9 +347,38 @@ func TestAgent_Integration(t *testing.T) {
 	case result := <-resultCh:
 		assert.Equal(t, task.ID, result.ID)
 		assert.Equal(t, float64(15), result.Result)
+		assert.Equal(t, "lease-1", result.LeaseToken)
+		assert.GreaterOrEqual(t, extensions.Load(), int32(1))
 	case <-time.After(5 * time.Second):
 		t.Fatal("timeout waiting for result")
 	}
+
+	// Ошибка вычисления не останавливает агента: он сообщает о ней оркестратору
+	// и продолжает брать задачи.
+	for _, task := range []models.Task{
+		{ID: "bad-task", Operation: "/", Arg1: models.Literal(1), Arg2: models.Literal(0)},
+		{ID: "nan-task", Operation: "^", Arg1: models.Literal(-1), Arg2: models.Literal(0.5)},
+		{ID: "next-task", Operation: "*", Arg1: models.Literal(2), Arg2: models.Literal(3)},
+	} {
+		select {
+		case taskCh <- task:
+		case <-time.After(2 * time.Second):
+			t.Fatal("timeout sending task")
+		}
+	}
+
+	for _, expected := range []models.TaskResult{
+		{ID: "bad-task", Error: common.ErrDivisionByZero},
+		{ID: "nan-task", Error: common.ErrNonFiniteResult},
+		{ID: "next-task", Result: 6},
+	} {
+		select {
+		case result := <-resultCh:
+			assert.Equal(t, expected, result)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for result")
+		}
+	}
 }
 
 func TestAgent_Config(t *testing.T) {
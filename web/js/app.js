@@ -91,7 +91,9 @@ function loadExpressions() {
                 item.appendChild(status);
 
                 if (expr.result !== undefined && expr.result !== null) {
-                    item.innerHTML += `<br><strong>Result:</strong> ${expr.result}`;
+                    item.innerHTML += `<br><strong>Result:</strong> ${expr.formatted_result || expr.result}`;
+                } else if (expr.matrix_result) {
+                    item.innerHTML += `<br><strong>Result:</strong> ${JSON.stringify(expr.matrix_result)}`;
                 }
 
                 if (expr.error) {
@@ -131,7 +133,10 @@ function loadExpressionDetail() {
 
             const resultElement = document.getElementById('expressionResult');
             if (expr.result !== undefined && expr.result !== null) {
-                resultElement.textContent = expr.result;
+                resultElement.textContent = expr.formatted_result || expr.result;
+                resultElement.parentElement.classList.remove('hidden');
+            } else if (expr.matrix_result) {
+                resultElement.textContent = JSON.stringify(expr.matrix_result);
                 resultElement.parentElement.classList.remove('hidden');
             } else {
                 resultElement.parentElement.classList.add('hidden');
@@ -144,6 +149,18 @@ function loadExpressionDetail() {
             } else {
                 errorElement.parentElement.classList.add('hidden');
             }
+
+            return fetch(`/api/v1/expressions/${expressionId}/steps`);
+        })
+        .then(response => response.ok ? response.json() : null)
+        .then(data => {
+            const stepsElement = document.getElementById('expressionSteps');
+            if (data && data.steps && data.steps.length > 1) {
+                stepsElement.textContent = data.steps.join(' → ');
+                stepsElement.parentElement.classList.remove('hidden');
+            } else {
+                stepsElement.parentElement.classList.add('hidden');
+            }
         })
         .catch(error => {
             showError(error.message);